@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -16,17 +17,20 @@ func main() {
 	// * Allow scrolling the viewport up and down
 	// * Allow moving the cursor to specific positions
 
-	if len(os.Args) != 2 {
+	recoverFile := flag.Bool("r", false, "recover unsaved changes from the file's swap file")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
 		log.Fatalln("must specify file path")
 	}
 
-	filepath := os.Args[1]
-	if err := editFile(filepath); err != nil {
+	if err := editFiles(flag.Args(), *recoverFile); err != nil {
 		log.Fatalln("failed to edit file:", err)
 	}
 }
 
-func editFile(path string) error {
+// editFiles opens the first file and adds the others to the buffer list
+func editFiles(paths []string, recoverFile bool) error {
 	logFile, err := os.Create("jim.log")
 	if err != nil {
 		return err
@@ -35,9 +39,16 @@ func editFile(path string) error {
 	if err := e.Setup(); err != nil {
 		return fmt.Errorf("editor setup: %w", err)
 	}
-	if err := e.LoadFile(path); err != nil {
+	load := e.LoadFile
+	if recoverFile {
+		load = e.RecoverFile
+	}
+	if err := load(paths[0]); err != nil {
 		return fmt.Errorf("editor edit file: %w", err)
 	}
+	for _, path := range paths[1:] {
+		e.AddFile(path)
+	}
 	if err := e.Start(); err != nil {
 		return fmt.Errorf("editor exited: %w", err)
 	}
@@ -5,6 +5,7 @@ go 1.22.2
 require (
 	github.com/muesli/termenv v0.15.2
 	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/sys v0.19.0
 	golang.org/x/term v0.19.0
 )
 
@@ -14,5 +15,4 @@ require (
 	github.com/mattn/go-isatty v0.0.18 // indirect
 	github.com/mattn/go-runewidth v0.0.14 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
-	golang.org/x/sys v0.19.0 // indirect
 )
@@ -0,0 +1,238 @@
+// Package charset detects the character encoding of files and converts their
+// contents to and from the UTF-8 text stored in buffers.
+//
+// Conversions are lossless: every byte sequence decoded from a file is
+// encoded back to the same bytes. Unpaired UTF-16 surrogates, which have no
+// UTF-8 representation, are stored using the generalized (WTF-8) encoding
+// and restored when encoding.
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type Encoding int
+
+const (
+	UTF8 Encoding = iota
+	UTF16LE
+	UTF16BE
+	Latin1
+)
+
+func (e Encoding) String() string {
+	return [...]string{"utf-8", "utf-16le", "utf-16be", "latin1"}[e]
+}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// Parse returns the encoding with the given name
+func Parse(name string) (Encoding, error) {
+	switch name {
+	case "utf-8", "utf8":
+		return UTF8, nil
+	case "utf-16le", "utf16le":
+		return UTF16LE, nil
+	case "utf-16", "utf16", "utf-16be", "utf16be":
+		return UTF16BE, nil
+	case "latin1", "iso-8859-1":
+		return Latin1, nil
+	}
+	return UTF8, fmt.Errorf("unsupported encoding: %s", name)
+}
+
+func (e Encoding) bom() []byte {
+	switch e {
+	case UTF8:
+		return bomUTF8
+	case UTF16LE:
+		return bomUTF16LE
+	case UTF16BE:
+		return bomUTF16BE
+	}
+	return nil
+}
+
+// Detect guesses the encoding of data and whether it starts with a byte
+// order mark. UTF-8 files with a few invalid bytes stay UTF-8, keeping those
+// bytes as they are. Other files that aren't UTF-8 or UTF-16 are treated as
+// Latin-1, which can represent any sequence of bytes.
+func Detect(data []byte) (enc Encoding, bom bool) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return UTF8, true
+	case bytes.HasPrefix(data, bomUTF16LE) && len(data)%2 == 0:
+		return UTF16LE, true
+	case bytes.HasPrefix(data, bomUTF16BE) && len(data)%2 == 0:
+		return UTF16BE, true
+	}
+	// ASCII text encoded as UTF-16 is also valid UTF-8, so check for it first
+	if enc, ok := detectUTF16(data); ok {
+		return enc, false
+	}
+	if looksLikeUTF8(data) {
+		return UTF8, false
+	}
+	return Latin1, false
+}
+
+// looksLikeUTF8 reports whether data is UTF-8 text, allowing for stray
+// invalid bytes. Latin-1 text has few if any byte sequences that happen to be
+// valid UTF-8, so data with at least as many multibyte characters as invalid
+// bytes is taken to be damaged UTF-8 rather than Latin-1.
+func looksLikeUTF8(data []byte) bool {
+	var multibyte, invalid int
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+		case size > 1:
+			multibyte++
+		}
+		i += size
+	}
+	return invalid == 0 || multibyte >= invalid
+}
+
+// detectUTF16 recognizes UTF-16 text without a byte order mark by the zero
+// high bytes of ASCII characters, which land on every other byte
+func detectUTF16(data []byte) (Encoding, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return UTF8, false
+	}
+	sample := data[:min(len(data), 1024)]
+	var evenZeros, oddZeros int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	units := len(sample) / 2
+	switch {
+	case oddZeros > units/2 && evenZeros == 0:
+		return UTF16LE, true
+	case evenZeros > units/2 && oddZeros == 0:
+		return UTF16BE, true
+	}
+	return UTF8, false
+}
+
+// Decode converts data in the given encoding to UTF-8, dropping the byte
+// order mark if there is one
+func Decode(data []byte, enc Encoding, bom bool) []byte {
+	if bom {
+		data = bytes.TrimPrefix(data, enc.bom())
+	}
+	switch enc {
+	case UTF16LE, UTF16BE:
+		return decodeUTF16(data, enc)
+	case Latin1:
+		out := make([]byte, 0, len(data))
+		for _, b := range data {
+			out = utf8.AppendRune(out, rune(b))
+		}
+		return out
+	}
+	return data
+}
+
+func decodeUTF16(data []byte, enc Encoding) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i+1 < len(data); i += 2 {
+		u := unit(data[i:], enc)
+		if utf16.IsSurrogate(rune(u)) && i+3 < len(data) {
+			if r := utf16.DecodeRune(rune(u), rune(unit(data[i+2:], enc))); r != utf8.RuneError {
+				out = utf8.AppendRune(out, r)
+				i += 2
+				continue
+			}
+		}
+		if utf16.IsSurrogate(rune(u)) {
+			out = appendSurrogate(out, u)
+			continue
+		}
+		out = utf8.AppendRune(out, rune(u))
+	}
+	return out
+}
+
+func unit(b []byte, enc Encoding) uint16 {
+	if enc == UTF16LE {
+		return uint16(b[0]) | uint16(b[1])<<8
+	}
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+// appendSurrogate appends the generalized UTF-8 encoding of a lone surrogate
+func appendSurrogate(out []byte, u uint16) []byte {
+	return append(out, 0xe0|byte(u>>12), 0x80|byte(u>>6)&0x3f, 0x80|byte(u)&0x3f)
+}
+
+// decodeSurrogate decodes a lone surrogate encoded by appendSurrogate
+func decodeSurrogate(s []byte) (uint16, bool) {
+	if len(s) < 3 || s[0] != 0xed || s[1] < 0xa0 || s[1] > 0xbf || s[2]&0xc0 != 0x80 {
+		return 0, false
+	}
+	return uint16(s[0]&0x0f)<<12 | uint16(s[1]&0x3f)<<6 | uint16(s[2]&0x3f), true
+}
+
+// Encode converts UTF-8 text to the given encoding, adding a byte order mark
+// if bom is set. It fails if the text contains characters that can't be
+// represented in the encoding.
+func Encode(text []byte, enc Encoding, bom bool) ([]byte, error) {
+	var out []byte
+	if bom {
+		out = append(out, enc.bom()...)
+	}
+	if enc == UTF8 {
+		return append(out, text...), nil
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		if r == utf8.RuneError && size <= 1 {
+			if u, ok := decodeSurrogate(text[i:]); ok && enc != Latin1 {
+				out = appendUnit(out, u, enc)
+				i += 3
+				continue
+			}
+			return nil, fmt.Errorf("invalid byte 0x%02x at offset %d can't be converted to %s", text[i], i, enc)
+		}
+		i += size
+
+		switch enc {
+		case Latin1:
+			if r > 0xff {
+				return nil, fmt.Errorf("character %q at offset %d can't be converted to %s", r, i-size, enc)
+			}
+			out = append(out, byte(r))
+		case UTF16LE, UTF16BE:
+			if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+				out = appendUnit(appendUnit(out, uint16(r1), enc), uint16(r2), enc)
+			} else {
+				out = appendUnit(out, uint16(r), enc)
+			}
+		}
+	}
+	return out, nil
+}
+
+func appendUnit(out []byte, u uint16, enc Encoding) []byte {
+	if enc == UTF16LE {
+		return append(out, byte(u), byte(u>>8))
+	}
+	return append(out, byte(u>>8), byte(u))
+}
@@ -0,0 +1,114 @@
+package charset
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		enc  Encoding
+		bom  bool
+	}{
+		{"empty", "", UTF8, false},
+		{"ascii", "hello\n", UTF8, false},
+		{"utf-8", "café\n", UTF8, false},
+		{"utf-8 bom", "\xef\xbb\xbfhi", UTF8, true},
+		{"utf-16le bom", "\xff\xfeh\x00i\x00", UTF16LE, true},
+		{"utf-16be bom", "\xfe\xff\x00h\x00i", UTF16BE, true},
+		{"utf-16le", "h\x00i\x00\n\x00", UTF16LE, false},
+		{"utf-16be", "\x00h\x00i\x00\n", UTF16BE, false},
+		{"latin-1", "caf\xe9\n", Latin1, false},
+		{"latin-1 with several accents", "d\xe9j\xe0 vu, na\xefve\n", Latin1, false},
+		{"utf-8 with a stray byte", "caf\xc3\xa9 \xff na\xc3\xafve\n", UTF8, false},
+		{"utf-8 with as many stray bytes", "\xc3\xa9\xff", UTF8, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, bom := Detect([]byte(tt.data))
+			if enc != tt.enc || bom != tt.bom {
+				t.Errorf("Detect(%q) = %v, %v, want %v, %v", tt.data, enc, bom, tt.enc, tt.bom)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		enc  Encoding
+		bom  bool
+		want string
+	}{
+		{"utf-8", "café", UTF8, false, "café"},
+		{"utf-8 bom", "\xef\xbb\xbfcafé", UTF8, true, "café"},
+		{"utf-8 invalid bytes kept", "a\xffb", UTF8, false, "a\xffb"},
+		{"utf-16le", "\xff\xfec\x00\xe9\x00", UTF16LE, true, "cé"},
+		{"utf-16be", "\x00c\x00\xe9", UTF16BE, false, "cé"},
+		{"utf-16le surrogate pair", "\x3d\xd8\x00\xde", UTF16LE, false, "😀"},
+		{"utf-16le lone surrogate", "\x3d\xd8a\x00", UTF16LE, false, "\xed\xa0\xbda"},
+		{"latin-1", "caf\xe9", Latin1, false, "café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Decode([]byte(tt.data), tt.enc, tt.bom)); got != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		enc  Encoding
+	}{
+		{"latin-1 out of range", "日本", Latin1},
+		{"latin-1 invalid byte", "a\xff", Latin1},
+		{"utf-16 invalid byte", "a\xff", UTF16LE},
+		{"latin-1 lone surrogate", "\xed\xa0\xbd", Latin1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Encode([]byte(tt.text), tt.enc, false); err == nil {
+				t.Errorf("Encode() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+// TestRoundTrip checks that decoding a file and encoding it again with the
+// detected encoding gives back the original bytes
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"ascii", "hello\nworld\n"},
+		{"utf-8", "日本語 café\n"},
+		{"utf-8 bom", "\xef\xbb\xbfcafé\n"},
+		{"utf-8 with stray bytes", "café \xff\xfe naïve\n"},
+		{"utf-16le bom", "\xff\xfeh\x00\xe9\x00\n\x00"},
+		{"utf-16be bom", "\xfe\xff\x00h\x00\xe9\x00\n"},
+		{"utf-16le lone surrogate", "\xff\xfe\x3d\xd8a\x00"},
+		{"utf-16be surrogate pair", "\xfe\xff\xd8\x3d\xde\x00"},
+		{"latin-1", "d\xe9j\xe0 vu\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, bom := Detect([]byte(tt.data))
+			text := Decode([]byte(tt.data), enc, bom)
+			got, err := Encode(text, enc, bom)
+			if err != nil {
+				t.Fatalf("Encode() as %v: %v", enc, err)
+			}
+			if !bytes.Equal(got, []byte(tt.data)) {
+				t.Errorf("round trip as %v = %q, want %q", enc, got, tt.data)
+			}
+		})
+	}
+}
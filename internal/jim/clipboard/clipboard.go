@@ -0,0 +1,113 @@
+// Package clipboard connects the + and * registers to the system clipboard
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/config"
+	"github.com/muesli/termenv"
+)
+
+// Selection is which of the system's clipboards to use. X11 has a primary
+// selection of the most recently selected text as well as the clipboard;
+// elsewhere both are the same clipboard.
+type Selection int
+
+const (
+	Clipboard Selection = iota
+	Primary
+)
+
+// Provider copies text to and pastes text from the system clipboard
+type Provider interface {
+	Copy(sel Selection, text string) error
+	Paste(sel Selection) (string, error)
+}
+
+// New returns the provider selected by the config, or nil if the + and *
+// registers are kept inside the editor. OSC 52 sequences are written to
+// output.
+func New(cfg config.ClipboardConfig, output *termenv.Output) (Provider, error) {
+	switch cfg.Provider {
+	case config.ClipboardNone:
+		return nil, nil
+	case config.ClipboardOSC52:
+		return &OSC52{output: output}, nil
+	case config.ClipboardCommand:
+		if len(cfg.CopyCommand) == 0 || len(cfg.PasteCommand) == 0 {
+			return nil, fmt.Errorf("clipboard: copy and paste commands are required")
+		}
+		c := &Command{
+			copy:  [2][]string{cfg.CopyCommand, cfg.PrimaryCopyCommand},
+			paste: [2][]string{cfg.PasteCommand, cfg.PrimaryPasteCommand},
+		}
+		if len(cfg.PrimaryCopyCommand) == 0 {
+			c.copy[Primary] = cfg.CopyCommand
+		}
+		if len(cfg.PrimaryPasteCommand) == 0 {
+			c.paste[Primary] = cfg.PasteCommand
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("clipboard: unknown provider: %q", cfg.Provider)
+}
+
+// OSC52 copies text by asking the terminal to do it with an OSC 52 escape
+// sequence, which works over SSH. Terminals rarely allow reading the
+// clipboard, so pasting returns the text copied last.
+type OSC52 struct {
+	output *termenv.Output
+	copied [2]string
+}
+
+func (o *OSC52) Copy(sel Selection, text string) error {
+	if sel == Primary {
+		o.output.CopyPrimary(text)
+	} else {
+		o.output.Copy(text)
+	}
+	o.copied[sel] = text
+	return nil
+}
+
+func (o *OSC52) Paste(sel Selection) (string, error) {
+	return o.copied[sel], nil
+}
+
+// Command copies and pastes by running external commands such as xclip or
+// wl-copy. Copy commands read the text from stdin and paste commands write it
+// to stdout.
+type Command struct {
+	copy  [2][]string
+	paste [2][]string
+}
+
+func (c *Command) Copy(sel Selection, text string) error {
+	args := c.copy[sel]
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	// Output isn't captured as commands like xclip stay in the background
+	// serving the selection with stdout and stderr still open
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("clipboard: %s: %w", args[0], err)
+	}
+	return nil
+}
+
+func (c *Command) Paste(sel Selection) (string, error) {
+	args := c.paste[sel]
+	cmd := exec.Command(args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("clipboard: %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("clipboard: %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
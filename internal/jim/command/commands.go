@@ -6,6 +6,13 @@ type Command interface {
 	command()
 }
 
+// Countable is implemented by commands that can apply a count themselves, such as moving the
+// cursor several lines at once
+type Countable interface {
+	Command
+	WithCount(count int) Command
+}
+
 // Noop does nothing. Used to satisfy the return type there is no action to take.
 type Noop struct{}
 
@@ -25,14 +32,18 @@ type InsertText struct {
 
 func (InsertText) command() {}
 
-// DeleteText deletes the given length of text starting from the current cursor position forward
-// or backward if length is negative
+// DeleteText deletes Length characters starting from the current cursor position forward, or
+// backward if Length is negative
 type DeleteText struct {
 	Length int
 }
 
 func (DeleteText) command() {}
 
+func (c DeleteText) WithCount(count int) Command {
+	return DeleteText{Length: c.Length * count}
+}
+
 // MoveCursorRelative moves the cursor position up and down and/or forward or backward the given
 // number of rows and/or columns
 type MoveCursorRelative struct {
@@ -42,6 +53,10 @@ type MoveCursorRelative struct {
 
 func (MoveCursorRelative) command() {}
 
+func (c MoveCursorRelative) WithCount(count int) Command {
+	return MoveCursorRelative{DeltaRows: c.DeltaRows * count, DeltaColumns: c.DeltaColumns * count}
+}
+
 // Exit signals the editor to shut down and exit the process
 type Exit struct{}
 
@@ -63,3 +78,422 @@ func (EvalLua) command() {}
 type Save struct{}
 
 func (Save) command() {}
+
+// Undo reverts the most recent change in the active buffer
+type Undo struct{}
+
+func (Undo) command() {}
+
+// Redo reapplies the most recently undone change in the active buffer
+type Redo struct{}
+
+func (Redo) command() {}
+
+// UndoEarlier moves the active buffer back in time through its undo history by the given number
+// of states, crossing undo branches
+type UndoEarlier struct {
+	Count int
+}
+
+func (UndoEarlier) command() {}
+
+func (c UndoEarlier) WithCount(count int) Command {
+	return UndoEarlier{Count: c.Count * count}
+}
+
+// UndoLater moves the active buffer forward in time through its undo history by the given number
+// of states, crossing undo branches
+type UndoLater struct {
+	Count int
+}
+
+func (UndoLater) command() {}
+
+func (c UndoLater) WithCount(count int) Command {
+	return UndoLater{Count: c.Count * count}
+}
+
+// UndoList shows the leaves of the active buffer's undo tree
+type UndoList struct{}
+
+func (UndoList) command() {}
+
+// CheckTime checks whether the file of the active buffer was changed on disk
+type CheckTime struct{}
+
+func (CheckTime) command() {}
+
+// SetOption changes or shows an option of the active buffer. Arg is in the form accepted by :set,
+// such as "fileformat=dos", "noeol" or "ff?"
+type SetOption struct {
+	Arg string
+}
+
+func (SetOption) command() {}
+
+// Repeat runs a command with a count. Countable commands apply the count themselves, others are
+// run count times.
+type Repeat struct {
+	Count   int
+	Command Command
+}
+
+func (Repeat) command() {}
+
+// Sequence runs several commands in order
+type Sequence struct {
+	Commands []Command
+}
+
+func (Sequence) command() {}
+
+// SwapSelectionEnds moves the cursor to the other end of the visual selection
+type SwapSelectionEnds struct{}
+
+func (SwapSelectionEnds) command() {}
+
+// BlockInsert starts inserting text before the visual block, or after it if Append is set. The
+// text typed on the first line is repeated on the others when leaving insert mode.
+type BlockInsert struct {
+	Append bool
+}
+
+func (BlockInsert) command() {}
+
+// SelectRegister selects the register used by the next yank, delete, change or put
+type SelectRegister struct {
+	Name rune
+}
+
+func (SelectRegister) command() {}
+
+func (c SelectRegister) WithChar(char rune) Command {
+	return SelectRegister{Name: char}
+}
+
+// Put inserts the contents of the selected register after the cursor, or before it if Before is
+// set. Lines are put below or above the current line.
+type Put struct {
+	Before bool
+	Count  int
+}
+
+func (Put) command() {}
+
+func (c Put) WithCount(count int) Command {
+	return Put{Before: c.Before, Count: count}
+}
+
+// InsertRegister inserts the contents of a register at the cursor
+type InsertRegister struct {
+	Name rune
+}
+
+func (InsertRegister) command() {}
+
+func (c InsertRegister) WithChar(char rune) Command {
+	return InsertRegister{Name: char}
+}
+
+// ShowRegisters shows the contents of the registers
+type ShowRegisters struct{}
+
+func (ShowRegisters) command() {}
+
+// RepeatChange repeats the last change made in normal mode. A count replaces the count of the
+// original change, or for text inserted in insert mode, inserts it count times.
+type RepeatChange struct {
+	Count int
+}
+
+func (RepeatChange) command() {}
+
+func (c RepeatChange) WithCount(count int) Command {
+	return RepeatChange{Count: count}
+}
+
+// RecordMacro starts recording the keys typed into a register. While recording, the key bound to
+// it stops recording instead.
+type RecordMacro struct {
+	Name rune
+}
+
+func (RecordMacro) command() {}
+
+func (c RecordMacro) WithChar(char rune) Command {
+	return RecordMacro{Name: char}
+}
+
+// PlayMacro types the keys stored in a register as if they were typed Count times. The register @
+// is the register played last.
+type PlayMacro struct {
+	Name  rune
+	Count int
+}
+
+func (PlayMacro) command() {}
+
+func (c PlayMacro) WithChar(char rune) Command {
+	return PlayMacro{Name: char, Count: c.Count}
+}
+
+func (c PlayMacro) WithCount(count int) Command {
+	return PlayMacro{Name: c.Name, Count: count}
+}
+
+// StartSearch prompts for a pattern to search for forward (/), or backward (?) if Backward is
+// set, moving to the first match as the pattern is typed
+type StartSearch struct {
+	Backward bool
+}
+
+func (StartSearch) command() {}
+
+// NoHighlight stops highlighting the matches of the last search until the next one
+type NoHighlight struct{}
+
+func (NoHighlight) command() {}
+
+// Substitute replaces matches of a Vim regular expression in the lines from FirstLine to LastLine
+// (:s). The replacement refers to the whole match with & or \0 and to groups with \1 to \9, and
+// changes the case of what follows with \u, \l, \U, \L and \E.
+type Substitute struct {
+	FirstLine   int
+	LastLine    int
+	Pattern     string
+	Replacement string
+	// Global replaces every match in a line instead of only the first
+	Global bool
+	// Confirm asks before each replacement
+	Confirm bool
+	// IgnoreCase and MatchCase override the ignorecase and smartcase options
+	IgnoreCase bool
+	MatchCase  bool
+	// CountOnly counts the matches instead of replacing them
+	CountOnly bool
+	// Repeat repeats the pattern and replacement of the last substitution
+	Repeat bool
+}
+
+func (Substitute) command() {}
+
+// SetMark sets a mark named a to z at the cursor (m)
+type SetMark struct {
+	Name rune
+}
+
+func (SetMark) command() {}
+
+func (c SetMark) WithChar(char rune) Command {
+	return SetMark{Name: char}
+}
+
+// DeleteLines deletes the lines from FirstLine to LastLine into a register (:d)
+type DeleteLines struct {
+	FirstLine int
+	LastLine  int
+	Register  rune
+}
+
+func (DeleteLines) command() {}
+
+// CopyLines puts a copy of the lines from FirstLine to LastLine below the line Address, which is
+// 0 to put them above the first line (:copy). Move deletes the original lines (:move).
+type CopyLines struct {
+	FirstLine int
+	LastLine  int
+	Address   int
+	Move      bool
+}
+
+func (CopyLines) command() {}
+
+// Normal types Keys in normal mode, once on each line from FirstLine to LastLine, or at the cursor
+// if FirstLine is 0 (:normal). Keys are written in key notation, such as "A;<Esc>".
+type Normal struct {
+	FirstLine int
+	LastLine  int
+	Keys      string
+}
+
+func (Normal) command() {}
+
+// Global runs the ex command Command on each line from FirstLine to LastLine that matches Pattern,
+// or that doesn't if Invert is set (:global, :vglobal)
+type Global struct {
+	FirstLine int
+	LastLine  int
+	Pattern   string
+	Command   string
+	Invert    bool
+}
+
+func (Global) command() {}
+
+// Ex runs a line of ex commands, parsed when it runs. Column is where Line starts in the command
+// line it was typed in, for pointing at errors.
+type Ex struct {
+	Line   string
+	Column int
+}
+
+func (Ex) command() {}
+
+// Write writes the lines from FirstLine to LastLine of the active buffer to the file at Path, or to
+// the buffer's own file if Path is empty (:write). A FirstLine of 0 writes the whole buffer. Append
+// adds the lines to the end of the file instead of replacing it, and Force overwrites files that
+// exist or were changed on disk. With Modified set nothing is written unless the buffer has unsaved
+// changes (:update, :xit), and Quit exits the editor once the lines are written (:wq).
+type Write struct {
+	FirstLine int
+	LastLine  int
+	Path      string
+	Append    bool
+	Force     bool
+	Modified  bool
+	Quit      bool
+}
+
+func (Write) command() {}
+
+// WriteAll saves every modified buffer, then exits the editor if Quit is set (:wall, :wqall)
+type WriteAll struct {
+	Quit bool
+}
+
+func (WriteAll) command() {}
+
+// SaveAs writes the active buffer to the file at Path, which becomes the buffer's file. Force
+// overwrites a file that exists (:saveas).
+type SaveAs struct {
+	Path  string
+	Force bool
+}
+
+func (SaveAs) command() {}
+
+// Edit opens the file at Path in the active window, or reloads the buffer's file if Path is empty.
+// Force throws away unsaved changes (:edit).
+type Edit struct {
+	Path  string
+	Force bool
+}
+
+func (Edit) command() {}
+
+// Read puts the lines of the file at Path below Line, or above the first line if Line is 0. An empty
+// Path reads the buffer's own file (:read).
+type Read struct {
+	Line int
+	Path string
+}
+
+func (Read) command() {}
+
+// Quit closes the active window, or exits the editor if it's the last one unless a buffer has
+// unsaved changes. Force exits anyway, throwing the changes away, and All exits whatever the
+// windows are (:quit, :qall).
+type Quit struct {
+	Force bool
+	All   bool
+}
+
+func (Quit) command() {}
+
+// ShowBuffers lists the buffers in the buffer list (:ls)
+type ShowBuffers struct{}
+
+func (ShowBuffers) command() {}
+
+// SwitchBuffer shows the buffer with the given Number in the active window, or the one whose name
+// contains Name if Number is 0 (:buffer)
+type SwitchBuffer struct {
+	Number int
+	Name   string
+}
+
+func (SwitchBuffer) command() {}
+
+// SwitchBufferRelative shows the buffer Delta places after the active one in the buffer list,
+// wrapping around at the ends (:bnext, :bprevious)
+type SwitchBufferRelative struct {
+	Delta int
+}
+
+func (SwitchBufferRelative) command() {}
+
+// DeleteBuffer removes the buffer with the given Number from the buffer list, or the one whose name
+// contains Name, or the active buffer if neither is given. Force throws away unsaved changes
+// (:bdelete).
+type DeleteBuffer struct {
+	Number int
+	Name   string
+	Force  bool
+}
+
+func (DeleteBuffer) command() {}
+
+// AlternateBuffer shows the buffer that was shown before the active one, or the buffer with the
+// given Number if it isn't 0
+type AlternateBuffer struct {
+	Number int
+}
+
+func (AlternateBuffer) command() {}
+
+func (AlternateBuffer) WithCount(count int) Command {
+	return AlternateBuffer{Number: count}
+}
+
+// SplitWindow splits the active window in two, one above the other or side by side if Vertical is
+// set. The new window shows the file at Path, or the same buffer if Path is empty (:split, :vsplit).
+type SplitWindow struct {
+	Vertical bool
+	Path     string
+}
+
+func (SplitWindow) command() {}
+
+// FocusWindow moves to the window next to the active one in a direction: 'h' for left, 'j' for
+// down, 'k' for up or 'l' for right. Direction 'w' moves to the next window in the layout,
+// wrapping around.
+type FocusWindow struct {
+	Direction rune
+}
+
+func (FocusWindow) command() {}
+
+// EqualizeWindows makes all windows the same size
+type EqualizeWindows struct{}
+
+func (EqualizeWindows) command() {}
+
+// ResizeWindow changes the height of the active window by Delta rows, or its width by Delta
+// columns if Vertical is set. With Absolute set the size becomes Delta instead, or as large as
+// possible if Delta is 0 (:resize).
+type ResizeWindow struct {
+	Delta    int
+	Absolute bool
+	Vertical bool
+}
+
+func (ResizeWindow) command() {}
+
+func (c ResizeWindow) WithCount(count int) Command {
+	if c.Absolute {
+		c.Delta = count
+	} else {
+		c.Delta *= count
+	}
+	return c
+}
+
+// CloseWindow closes the active window, unless it's the last one (:close)
+type CloseWindow struct{}
+
+func (CloseWindow) command() {}
+
+// OnlyWindow closes every window but the active one (:only)
+type OnlyWindow struct{}
+
+func (OnlyWindow) command() {}
@@ -0,0 +1,216 @@
+package command
+
+// Operator is an action applied to the text covered by a motion or text object
+type Operator int
+
+const (
+	OperatorDelete Operator = iota
+	OperatorChange
+	OperatorYank
+	OperatorIndent
+	OperatorDedent
+	OperatorLowercase
+	OperatorUppercase
+)
+
+func (o Operator) String() string {
+	return [...]string{"d", "c", "y", ">", "<", "gu", "gU"}[o]
+}
+
+// Motion is implemented by commands that move the cursor. In operator-pending mode the operator is
+// applied to the text between the cursor and where the motion would move it.
+type Motion interface {
+	Command
+	motion()
+}
+
+// TextObject is implemented by commands that select a region of text around the cursor for an
+// operator to act on
+type TextObject interface {
+	Command
+	textObject()
+}
+
+// CharArgument is implemented by commands that take the character typed after their key binding,
+// such as the character to find for f
+type CharArgument interface {
+	Command
+	WithChar(c rune) Command
+}
+
+// BeginOperator switches to operator-pending mode to wait for the motion or text object the
+// operator applies to. Count multiplies the count given to the motion.
+type BeginOperator struct {
+	Operator Operator
+	Count    int
+}
+
+func (BeginOperator) command() {}
+
+func (c BeginOperator) WithCount(count int) Command {
+	return BeginOperator{Operator: c.Operator, Count: max(c.Count, 1) * count}
+}
+
+// ApplyOperator applies an operator to the text covered by a motion or text object, which is given
+// the count if it's greater than zero
+type ApplyOperator struct {
+	Operator Operator
+	// Target is a Motion or TextObject
+	Target Command
+	Count  int
+}
+
+func (ApplyOperator) command() {}
+
+func (c ApplyOperator) WithCount(count int) Command {
+	return ApplyOperator{Operator: c.Operator, Target: c.Target, Count: max(c.Count, 1) * count}
+}
+
+func (MoveCursorRelative) motion() {}
+
+// WordForward moves to the start of the next word (w)
+type WordForward struct{}
+
+func (WordForward) command() {}
+func (WordForward) motion()  {}
+
+// WordBackward moves to the start of the previous word (b)
+type WordBackward struct{}
+
+func (WordBackward) command() {}
+func (WordBackward) motion()  {}
+
+// WordEnd moves to the end of the next word (e)
+type WordEnd struct{}
+
+func (WordEnd) command() {}
+func (WordEnd) motion()  {}
+
+// LineStart moves to the first column of the line (0)
+type LineStart struct{}
+
+func (LineStart) command() {}
+func (LineStart) motion()  {}
+
+// LineEnd moves to the last character of the line, or of the line count-1 lines down ($)
+type LineEnd struct{}
+
+func (LineEnd) command() {}
+func (LineEnd) motion()  {}
+
+// GotoLine moves to the first non-blank character of a line. Line 0 is the last line of the
+// buffer. A count replaces the line (gg, G).
+type GotoLine struct {
+	Line int
+}
+
+func (GotoLine) command() {}
+func (GotoLine) motion()  {}
+
+// Lines covers the current line and the count-1 lines below it. Typing an operator twice, as in
+// dd or >>, applies it to Lines.
+type Lines struct{}
+
+func (Lines) command() {}
+func (Lines) motion()  {}
+
+// FindChar moves to the next occurrence of Char in the line, or just before it if Till is set
+// (f, t). Backward searches toward the start of the line instead (F, T).
+type FindChar struct {
+	Char     rune
+	Till     bool
+	Backward bool
+}
+
+func (FindChar) command() {}
+func (FindChar) motion()  {}
+
+func (c FindChar) WithChar(char rune) Command {
+	return FindChar{Char: char, Till: c.Till, Backward: c.Backward}
+}
+
+// MatchPair moves to the bracket matching the next bracket at or after the cursor in the line (%)
+type MatchPair struct{}
+
+func (MatchPair) command() {}
+func (MatchPair) motion()  {}
+
+// Search moves to the start of the next match of a Vim regular expression, or the previous one if
+// Backward is set, wrapping around the ends of the buffer
+type Search struct {
+	Pattern  string
+	Backward bool
+}
+
+func (Search) command() {}
+func (Search) motion()  {}
+
+// SearchNext repeats the last search in the same direction, or the opposite one if Reverse is set
+// (n, N)
+type SearchNext struct {
+	Reverse bool
+}
+
+func (SearchNext) command() {}
+func (SearchNext) motion()  {}
+
+// SearchWord searches forward for the word under the cursor, or backward if Backward is set (*, #)
+type SearchWord struct {
+	Backward bool
+}
+
+func (SearchWord) command() {}
+func (SearchWord) motion()  {}
+
+// GotoMark moves to a mark set with m, or to the first non-blank character of its line if Line is
+// set (`, ')
+type GotoMark struct {
+	Name rune
+	Line bool
+}
+
+func (GotoMark) command() {}
+func (GotoMark) motion()  {}
+
+func (c GotoMark) WithChar(char rune) Command {
+	return GotoMark{Name: char, Line: c.Line}
+}
+
+// SelectWord selects the word under the cursor, and the whitespace after it unless Inner is set
+// (iw, aw)
+type SelectWord struct {
+	Inner bool
+}
+
+func (SelectWord) command()    {}
+func (SelectWord) textObject() {}
+
+// SelectQuoted selects the text between the quotes around the cursor, and the quotes and the
+// whitespace after them unless Inner is set (i", a")
+type SelectQuoted struct {
+	Quote rune
+	Inner bool
+}
+
+func (SelectQuoted) command()    {}
+func (SelectQuoted) textObject() {}
+
+// SelectBlock selects the text between the Open and Close brackets around the cursor, and the
+// brackets themselves unless Inner is set (i(, a()
+type SelectBlock struct {
+	Open  rune
+	Close rune
+	Inner bool
+}
+
+func (SelectBlock) command()    {}
+func (SelectBlock) textObject() {}
+
+// SelectParagraph selects the paragraph the cursor is in, and the blank lines after it unless
+// Inner is set (ip, ap)
+type SelectParagraph struct {
+	Inner bool
+}
+
+func (SelectParagraph) command()    {}
+func (SelectParagraph) textObject() {}
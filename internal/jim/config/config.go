@@ -1,22 +1,69 @@
 package config
 
 import (
+	"time"
+
 	"github.com/jstotz/jim/internal/jim/command"
 	"github.com/jstotz/jim/internal/jim/modes"
 )
 
+type Config struct {
+	KeyBindings []KeyBinding
+	// Leader is the key that <leader> stands for in key bindings
+	Leader rune
+	// TimeoutLen is how long to wait for the next key of a key binding when the keys typed so far
+	// are also a complete binding
+	TimeoutLen time.Duration
+	// EscTimeout is how long to wait after the escape key for the rest of a terminal escape
+	// sequence before treating it as a keypress of its own
+	EscTimeout time.Duration
+	// Backup keeps a copy of a file's previous contents at path~ when saving it
+	Backup bool
+	// SwapFile journals unsaved changes to a swap file so they can be recovered after a crash
+	SwapFile bool
+	// LargeFileSize is the size in bytes from which files are paged in from disk as needed instead
+	// of being read into memory
+	LargeFileSize int64
+	// UpdateTime is how often unsaved changes are written to swap files
+	UpdateTime time.Duration
+	// IgnoreCase makes searches ignore case
+	IgnoreCase bool
+	// SmartCase makes searches for patterns containing uppercase letters match case even if
+	// IgnoreCase is set
+	SmartCase bool
+	// Clipboard is how the + and * registers reach the system clipboard
+	Clipboard ClipboardConfig
+}
+
+type ClipboardProvider string
+
 const (
-	KeyEnter     = rune(13)
-	KeyEscape    = rune(27)
-	KeyBackspace = rune(127)
+	// ClipboardNone keeps the + and * registers inside the editor
+	ClipboardNone ClipboardProvider = "none"
+	// ClipboardOSC52 copies through the terminal with OSC 52 escape sequences, which also works
+	// over SSH. Pasting only returns text copied from the editor.
+	ClipboardOSC52 ClipboardProvider = "osc52"
+	// ClipboardCommand runs the configured copy and paste commands
+	ClipboardCommand ClipboardProvider = "command"
 )
 
-type Config struct {
-	KeyBindings []KeyBinding
+type ClipboardConfig struct {
+	Provider ClipboardProvider
+	// CopyCommand is run with the text on stdin to copy it for the + register when using
+	// ClipboardCommand, e.g. ["xclip", "-selection", "clipboard"] or ["wl-copy"]
+	CopyCommand []string
+	// PasteCommand is run to read the + register from its stdout, e.g.
+	// ["xclip", "-selection", "clipboard", "-o"] or ["wl-paste", "--no-newline"]
+	PasteCommand []string
+	// PrimaryCopyCommand and PrimaryPasteCommand do the same for the * register and the X11
+	// primary selection. They default to the + register's commands.
+	PrimaryCopyCommand  []string
+	PrimaryPasteCommand []string
 }
 
 type KeyBinding struct {
-	Mode    modes.Mode
+	Mode modes.Mode
+	// Keys is the key sequence in Vim's key notation, e.g. "gg", "<C-w>j", "<M-x>" or "<F5>"
 	Keys    string
 	Command command.Command
 }
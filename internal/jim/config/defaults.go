@@ -1,12 +1,23 @@
 package config
 
 import (
+	"time"
+
 	"github.com/jstotz/jim/internal/jim/command"
 	"github.com/jstotz/jim/internal/jim/modes"
 )
 
 func DefaultConfig() Config {
-	return Config{
+	cfg := Config{
+		Leader:        '\\',
+		TimeoutLen:    time.Second,
+		EscTimeout:    50 * time.Millisecond,
+		SwapFile:      true,
+		UpdateTime:    4 * time.Second,
+		LargeFileSize: 64 * 1024 * 1024,
+		IgnoreCase:    true,
+		SmartCase:     true,
+		Clipboard:     ClipboardConfig{Provider: ClipboardOSC52},
 		KeyBindings: []KeyBinding{
 			// Normal mode bindings
 			{
@@ -22,65 +33,307 @@ func DefaultConfig() Config {
 			{
 				Mode:    modes.ModeNormal,
 				Keys:    "q",
-				Command: command.Exit{},
+				Command: command.RecordMacro{},
 			},
 			{
 				Mode:    modes.ModeNormal,
-				Keys:    "j",
-				Command: command.MoveCursorRelative{DeltaRows: 1, DeltaColumns: 0},
+				Keys:    "@",
+				Command: command.PlayMacro{},
 			},
 			{
 				Mode:    modes.ModeNormal,
-				Keys:    "k",
-				Command: command.MoveCursorRelative{DeltaRows: -1, DeltaColumns: 0},
+				Keys:    "m",
+				Command: command.SetMark{},
 			},
 			{
 				Mode:    modes.ModeNormal,
-				Keys:    "h",
+				Keys:    "<BS>",
 				Command: command.MoveCursorRelative{DeltaRows: 0, DeltaColumns: -1},
 			},
 			{
 				Mode:    modes.ModeNormal,
-				Keys:    string(KeyBackspace),
+				Keys:    "<Up>",
+				Command: command.MoveCursorRelative{DeltaRows: -1, DeltaColumns: 0},
+			},
+			{
+				Mode:    modes.ModeNormal,
+				Keys:    "<Down>",
+				Command: command.MoveCursorRelative{DeltaRows: 1, DeltaColumns: 0},
+			},
+			{
+				Mode:    modes.ModeNormal,
+				Keys:    "<Left>",
 				Command: command.MoveCursorRelative{DeltaRows: 0, DeltaColumns: -1},
 			},
 			{
 				Mode:    modes.ModeNormal,
-				Keys:    "l",
+				Keys:    "<Right>",
 				Command: command.MoveCursorRelative{DeltaRows: 0, DeltaColumns: 1},
 			},
 			{
 				Mode:    modes.ModeNormal,
-				Keys:    "x",
-				Command: command.DeleteText{Length: 1},
+				Keys:    ".",
+				Command: command.RepeatChange{},
+			},
+			{
+				Mode:    modes.ModeNormal,
+				Keys:    "u",
+				Command: command.Undo{},
+			},
+			{
+				Mode:    modes.ModeNormal,
+				Keys:    "<C-r>",
+				Command: command.Redo{},
+			},
+			{
+				Mode:    modes.ModeNormal,
+				Keys:    "g-",
+				Command: command.UndoEarlier{Count: 1},
+			},
+			{
+				Mode:    modes.ModeNormal,
+				Keys:    "g+",
+				Command: command.UndoLater{Count: 1},
+			},
+			{
+				Mode:    modes.ModeNormal,
+				Keys:    "<C-^>",
+				Command: command.AlternateBuffer{},
 			},
 			// Insert mode bindings
 			{
 				Mode:    modes.ModeInsert,
-				Keys:    string(KeyEscape),
+				Keys:    "<Esc>",
 				Command: command.ActivateMode{Mode: modes.ModeNormal},
 			},
 			{
 				Mode:    modes.ModeInsert,
-				Keys:    string(KeyBackspace),
+				Keys:    "<BS>",
 				Command: command.DeleteText{Length: -1},
 			},
+			{
+				Mode:    modes.ModeInsert,
+				Keys:    "<CR>",
+				Command: command.InsertText{Text: "\n"},
+			},
+			{
+				Mode:    modes.ModeInsert,
+				Keys:    "<Up>",
+				Command: command.MoveCursorRelative{DeltaRows: -1, DeltaColumns: 0},
+			},
+			{
+				Mode:    modes.ModeInsert,
+				Keys:    "<Down>",
+				Command: command.MoveCursorRelative{DeltaRows: 1, DeltaColumns: 0},
+			},
+			{
+				Mode:    modes.ModeInsert,
+				Keys:    "<Left>",
+				Command: command.MoveCursorRelative{DeltaRows: 0, DeltaColumns: -1},
+			},
+			{
+				Mode:    modes.ModeInsert,
+				Keys:    "<Right>",
+				Command: command.MoveCursorRelative{DeltaRows: 0, DeltaColumns: 1},
+			},
 			// Command mode bindings
 			{
 				Mode:    modes.ModeCommand,
-				Keys:    string(KeyEnter),
+				Keys:    "<CR>",
 				Command: command.EvalCommandBuffer{},
 			},
 			{
 				Mode:    modes.ModeCommand,
-				Keys:    string(KeyEscape),
+				Keys:    "<Esc>",
 				Command: command.ActivateMode{Mode: modes.ModeNormal},
 			},
 			{
 				Mode:    modes.ModeCommand,
-				Keys:    string(KeyBackspace),
+				Keys:    "<BS>",
 				Command: command.DeleteText{Length: -1},
 			},
 		},
 	}
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeNormal, operators)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeNormal, motions)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeOperatorPending, motions)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeOperatorPending, textObjects)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeOperatorPending, operatorLines)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeNormal, searches)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeOperatorPending, searches)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeNormal, visualModes)...)
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeNormal, windowCommands)...)
+	for _, mode := range []modes.Mode{modes.ModeVisual, modes.ModeVisualLine, modes.ModeVisualBlock} {
+		cfg.KeyBindings = append(cfg.KeyBindings, bindAll(mode, motions)...)
+		cfg.KeyBindings = append(cfg.KeyBindings, bindAll(mode, textObjects)...)
+		cfg.KeyBindings = append(cfg.KeyBindings, bindAll(mode, visualModes)...)
+		cfg.KeyBindings = append(cfg.KeyBindings, bindAll(mode, visualOperators)...)
+	}
+	cfg.KeyBindings = append(cfg.KeyBindings, bindAll(modes.ModeVisualBlock, blockInserts)...)
+	for _, mode := range []modes.Mode{modes.ModeInsert, modes.ModeCommand} {
+		cfg.KeyBindings = append(cfg.KeyBindings, KeyBinding{Mode: mode, Keys: "<C-r>", Command: command.InsertRegister{}})
+	}
+	return cfg
+}
+
+// bindAll binds each key sequence to its command in the given mode
+func bindAll(mode modes.Mode, commands map[string]command.Command) []KeyBinding {
+	bindings := make([]KeyBinding, 0, len(commands))
+	for keys, cmd := range commands {
+		bindings = append(bindings, KeyBinding{Mode: mode, Keys: keys, Command: cmd})
+	}
+	return bindings
+}
+
+var operators = map[string]command.Command{
+	"d":    command.BeginOperator{Operator: command.OperatorDelete},
+	"c":    command.BeginOperator{Operator: command.OperatorChange},
+	"y":    command.BeginOperator{Operator: command.OperatorYank},
+	">":    command.BeginOperator{Operator: command.OperatorIndent},
+	"<lt>": command.BeginOperator{Operator: command.OperatorDedent},
+	"gu":   command.BeginOperator{Operator: command.OperatorLowercase},
+	"gU":   command.BeginOperator{Operator: command.OperatorUppercase},
+	"D":    command.ApplyOperator{Operator: command.OperatorDelete, Target: command.LineEnd{}},
+	"C":    command.ApplyOperator{Operator: command.OperatorChange, Target: command.LineEnd{}},
+	"Y":    command.ApplyOperator{Operator: command.OperatorYank, Target: command.Lines{}},
+	"x":    command.ApplyOperator{Operator: command.OperatorDelete, Target: command.MoveCursorRelative{DeltaColumns: 1}},
+	"X":    command.ApplyOperator{Operator: command.OperatorDelete, Target: command.MoveCursorRelative{DeltaColumns: -1}},
+	"p":    command.Put{},
+	"P":    command.Put{Before: true},
+	"\"":   command.SelectRegister{},
+}
+
+// motions move the cursor in normal mode and give operators the text to act
+// on in operator-pending mode
+var motions = map[string]command.Command{
+	"h":      command.MoveCursorRelative{DeltaColumns: -1},
+	"j":      command.MoveCursorRelative{DeltaRows: 1},
+	"k":      command.MoveCursorRelative{DeltaRows: -1},
+	"l":      command.MoveCursorRelative{DeltaColumns: 1},
+	"w":      command.WordForward{},
+	"b":      command.WordBackward{},
+	"e":      command.WordEnd{},
+	"0":      command.LineStart{},
+	"$":      command.LineEnd{},
+	"gg":     command.GotoLine{Line: 1},
+	"G":      command.GotoLine{},
+	"f":      command.FindChar{},
+	"t":      command.FindChar{Till: true},
+	"F":      command.FindChar{Backward: true},
+	"T":      command.FindChar{Till: true, Backward: true},
+	"%":      command.MatchPair{},
+	"'":      command.GotoMark{Line: true},
+	"`":      command.GotoMark{},
+	"n":      command.SearchNext{},
+	"N":      command.SearchNext{Reverse: true},
+	"*":      command.SearchWord{},
+	"#":      command.SearchWord{Backward: true},
+	"<Home>": command.LineStart{},
+	"<End>":  command.LineEnd{},
+}
+
+var textObjects = map[string]command.Command{
+	"iw":    command.SelectWord{Inner: true},
+	"aw":    command.SelectWord{},
+	"i\"":   command.SelectQuoted{Quote: '"', Inner: true},
+	"a\"":   command.SelectQuoted{Quote: '"'},
+	"i'":    command.SelectQuoted{Quote: '\'', Inner: true},
+	"a'":    command.SelectQuoted{Quote: '\''},
+	"i`":    command.SelectQuoted{Quote: '`', Inner: true},
+	"a`":    command.SelectQuoted{Quote: '`'},
+	"i(":    command.SelectBlock{Open: '(', Close: ')', Inner: true},
+	"a(":    command.SelectBlock{Open: '(', Close: ')'},
+	"i)":    command.SelectBlock{Open: '(', Close: ')', Inner: true},
+	"a)":    command.SelectBlock{Open: '(', Close: ')'},
+	"ib":    command.SelectBlock{Open: '(', Close: ')', Inner: true},
+	"ab":    command.SelectBlock{Open: '(', Close: ')'},
+	"i[":    command.SelectBlock{Open: '[', Close: ']', Inner: true},
+	"a[":    command.SelectBlock{Open: '[', Close: ']'},
+	"i]":    command.SelectBlock{Open: '[', Close: ']', Inner: true},
+	"a]":    command.SelectBlock{Open: '[', Close: ']'},
+	"i{":    command.SelectBlock{Open: '{', Close: '}', Inner: true},
+	"a{":    command.SelectBlock{Open: '{', Close: '}'},
+	"i}":    command.SelectBlock{Open: '{', Close: '}', Inner: true},
+	"a}":    command.SelectBlock{Open: '{', Close: '}'},
+	"iB":    command.SelectBlock{Open: '{', Close: '}', Inner: true},
+	"aB":    command.SelectBlock{Open: '{', Close: '}'},
+	"i<lt>": command.SelectBlock{Open: '<', Close: '>', Inner: true},
+	"a<lt>": command.SelectBlock{Open: '<', Close: '>'},
+	"i>":    command.SelectBlock{Open: '<', Close: '>', Inner: true},
+	"a>":    command.SelectBlock{Open: '<', Close: '>'},
+	"ip":    command.SelectParagraph{Inner: true},
+	"ap":    command.SelectParagraph{},
+}
+
+// searches open the search prompt to move to a match, or in operator-pending
+// mode to apply the operator up to it
+var searches = map[string]command.Command{
+	"/": command.StartSearch{},
+	"?": command.StartSearch{Backward: true},
+}
+
+// operatorLines are the keys that repeat an operator to apply it to whole
+// lines, as in dd, >> or gUU
+var operatorLines = map[string]command.Command{
+	"d":     command.Lines{},
+	"c":     command.Lines{},
+	"y":     command.Lines{},
+	">":     command.Lines{},
+	"<lt>":  command.Lines{},
+	"u":     command.Lines{},
+	"gu":    command.Lines{},
+	"U":     command.Lines{},
+	"gU":    command.Lines{},
+	"<Esc>": command.ActivateMode{Mode: modes.ModeNormal},
+}
+
+var visualModes = map[string]command.Command{
+	"v":     command.ActivateMode{Mode: modes.ModeVisual},
+	"V":     command.ActivateMode{Mode: modes.ModeVisualLine},
+	"<C-v>": command.ActivateMode{Mode: modes.ModeVisualBlock},
+}
+
+// visualOperators apply an operator to the selection in visual modes
+var visualOperators = map[string]command.Command{
+	"d":     command.BeginOperator{Operator: command.OperatorDelete},
+	"x":     command.BeginOperator{Operator: command.OperatorDelete},
+	"<Del>": command.BeginOperator{Operator: command.OperatorDelete},
+	"c":     command.BeginOperator{Operator: command.OperatorChange},
+	"s":     command.BeginOperator{Operator: command.OperatorChange},
+	"y":     command.BeginOperator{Operator: command.OperatorYank},
+	">":     command.BeginOperator{Operator: command.OperatorIndent},
+	"<lt>":  command.BeginOperator{Operator: command.OperatorDedent},
+	"u":     command.BeginOperator{Operator: command.OperatorLowercase},
+	"gu":    command.BeginOperator{Operator: command.OperatorLowercase},
+	"U":     command.BeginOperator{Operator: command.OperatorUppercase},
+	"gU":    command.BeginOperator{Operator: command.OperatorUppercase},
+	"o":     command.SwapSelectionEnds{},
+	"\"":    command.SelectRegister{},
+	"<Esc>": command.ActivateMode{Mode: modes.ModeNormal},
+}
+
+var blockInserts = map[string]command.Command{
+	"I": command.BlockInsert{},
+	"A": command.BlockInsert{Append: true},
+}
+
+// windowCommands are the CTRL-W commands that split, move between and resize
+// windows
+var windowCommands = map[string]command.Command{
+	"<C-w>s":    command.SplitWindow{},
+	"<C-w>v":    command.SplitWindow{Vertical: true},
+	"<C-w>h":    command.FocusWindow{Direction: 'h'},
+	"<C-w>j":    command.FocusWindow{Direction: 'j'},
+	"<C-w>k":    command.FocusWindow{Direction: 'k'},
+	"<C-w>l":    command.FocusWindow{Direction: 'l'},
+	"<C-w>w":    command.FocusWindow{Direction: 'w'},
+	"<C-w>=":    command.EqualizeWindows{},
+	"<C-w>+":    command.ResizeWindow{Delta: 1},
+	"<C-w>-":    command.ResizeWindow{Delta: -1},
+	"<C-w>>":    command.ResizeWindow{Delta: 1, Vertical: true},
+	"<C-w><lt>": command.ResizeWindow{Delta: -1, Vertical: true},
+	"<C-w>_":    command.ResizeWindow{Absolute: true},
+	"<C-w>|":    command.ResizeWindow{Absolute: true, Vertical: true},
+	"<C-w>o":    command.OnlyWindow{},
+	"<C-w>c":    command.CloseWindow{},
 }
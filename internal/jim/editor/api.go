@@ -4,6 +4,7 @@ import (
 	"bytes"
 
 	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/registers"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -50,6 +51,9 @@ func (m *APIModule) printFunction(l *lua.LState) *lua.LFunction {
 func (m *APIModule) exports() map[string]lua.LGFunction {
 	expts := map[string]lua.LGFunction{
 		"delete": m.apiDelete,
+		"on":     m.apiOn,
+		"getreg": m.apiGetReg,
+		"setreg": m.apiSetReg,
 	}
 	for name, fn := range expts {
 		expts[name] = m.wrapAPIFunction(name, fn)
@@ -79,3 +83,46 @@ func (m *APIModule) runCommand(l *lua.LState, cmd command.Command) int {
 func (m *APIModule) apiDelete(l *lua.LState) int {
 	return m.runCommand(l, command.DeleteText{Length: 1})
 }
+
+func (m *APIModule) apiOn(l *lua.LState) int {
+	m.editor.addEventHandler(l.CheckString(1), l.CheckFunction(2))
+	return 0
+}
+
+// apiGetReg returns the text and type ("c", "l" or "b") of a register
+func (m *APIModule) apiGetReg(l *lua.LState) int {
+	r, err := m.editor.registers.Get(registerName(l, 1))
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+	}
+	l.Push(lua.LString(r.Text))
+	l.Push(lua.LString(r.Type.String()))
+	return 2
+}
+
+// apiSetReg writes a register, optionally with a type ("c", "l" or "b")
+func (m *APIModule) apiSetReg(l *lua.LState) int {
+	name := registerName(l, 1)
+	typ, err := registers.ParseType(l.OptString(3, ""))
+	if err != nil {
+		l.RaiseError("%s", err.Error())
+	}
+	if err := m.editor.registers.Set(name, registers.Register{Text: l.CheckString(2), Type: typ}); err != nil {
+		l.RaiseError("%s", err.Error())
+	}
+	return 0
+}
+
+// registerName checks that the argument at n is a single character register
+// name. An empty name is the unnamed register.
+func registerName(l *lua.LState, n int) rune {
+	name := []rune(l.OptString(n, ""))
+	switch len(name) {
+	case 0:
+		return registers.Unnamed
+	case 1:
+		return name[0]
+	}
+	l.ArgError(n, "register name must be a single character")
+	return 0
+}
@@ -0,0 +1,309 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/command"
+)
+
+// listedBuffer is a buffer in the buffer list
+type listedBuffer struct {
+	// number identifies the buffer in :ls and :b. Numbers aren't reused.
+	number int
+	buffer Buffer
+	// loaded is whether the buffer was loaded. Files are only read the first
+	// time their buffer is shown.
+	loaded bool
+	// cursor is where the cursor was when the buffer was last shown
+	cursor Point
+}
+
+// name returns the path of a buffer's file, or "[No Name]"
+func (lb *listedBuffer) name() string {
+	if fb, ok := lb.buffer.(*FileBuffer); ok {
+		return fb.path
+	}
+	return "[No Name]"
+}
+
+// bufferList is the buffers open in the editor. Buffers that aren't shown
+// are hidden and keep their changes, saved or not.
+type bufferList struct {
+	buffers []*listedBuffer
+	// current is the buffer shown in the main window
+	current *listedBuffer
+	// alternate is the buffer that was shown before current, or nil
+	alternate  *listedBuffer
+	lastNumber int
+}
+
+// add adds a buffer to the end of the list
+func (l *bufferList) add(b Buffer) *listedBuffer {
+	l.lastNumber++
+	lb := &listedBuffer{number: l.lastNumber, buffer: b}
+	l.buffers = append(l.buffers, lb)
+	return lb
+}
+
+// remove removes a buffer from the list
+func (l *bufferList) remove(lb *listedBuffer) {
+	for i, other := range l.buffers {
+		if other == lb {
+			l.buffers = append(l.buffers[:i], l.buffers[i+1:]...)
+			break
+		}
+	}
+	if l.current == lb {
+		l.current = nil
+	}
+	if l.alternate == lb {
+		l.alternate = nil
+	}
+}
+
+// index returns the position of a buffer in the list, or -1
+func (l *bufferList) index(lb *listedBuffer) int {
+	for i, other := range l.buffers {
+		if other == lb {
+			return i
+		}
+	}
+	return -1
+}
+
+// entry returns the entry of a buffer in the list, or nil
+func (l *bufferList) entry(b Buffer) *listedBuffer {
+	for _, lb := range l.buffers {
+		if lb.buffer == b {
+			return lb
+		}
+	}
+	return nil
+}
+
+// find returns the buffer of the file at path, or nil
+func (l *bufferList) find(path string) *listedBuffer {
+	for _, lb := range l.buffers {
+		if fb, ok := lb.buffer.(*FileBuffer); ok && sameFile(fb.path, path) {
+			return lb
+		}
+	}
+	return nil
+}
+
+// lookup returns the buffer with a number, or the one whose name contains
+// name if number is 0
+func (l *bufferList) lookup(number int, name string) (*listedBuffer, error) {
+	if number > 0 {
+		for _, lb := range l.buffers {
+			if lb.number == number {
+				return lb, nil
+			}
+		}
+		return nil, fmt.Errorf("E86: Buffer %d does not exist", number)
+	}
+	if lb := l.find(name); lb != nil {
+		return lb, nil
+	}
+	var matches []*listedBuffer
+	for _, lb := range l.buffers {
+		if strings.Contains(lb.name(), name) {
+			matches = append(matches, lb)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("E94: No matching buffer for %s", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("E93: More than one match for %s", name)
+	}
+}
+
+// AddFile adds the file at path to the buffer list without showing it. The
+// file is read when its buffer is first shown.
+func (e *Editor) AddFile(path string) {
+	if e.buffers.find(path) == nil {
+		e.buffers.add(NewFileBuffer(path, e.fileBufferOptions(), e.Logger))
+	}
+}
+
+// showBuffer shows a buffer from the buffer list in the main window where
+// its cursor was left, loading it if it hasn't been. The buffer shown before
+// it becomes the alternate buffer.
+func (e *Editor) showBuffer(lb *listedBuffer) error {
+	w := e.window
+	if cur := e.buffers.current; cur != nil {
+		if cur == lb {
+			return nil
+		}
+		cur.cursor = w.CurrentPosition()
+		e.buffers.alternate = cur
+	}
+	e.buffers.current = lb
+	w.SetBuffer(lb.buffer)
+	e.registers.SetReadOnly('%', lb.name())
+	if alt := e.buffers.alternate; alt != nil {
+		e.registers.SetReadOnly('#', alt.name())
+	}
+
+	if lb.loaded {
+		row := max(min(lb.cursor.row, lb.buffer.LineCount()), 1)
+		w.SetPosition(Point{row: row, column: max(lb.cursor.column, 1)})
+		return e.checkTime()
+	}
+	lb.loaded = true
+	if err := lb.buffer.Load(); err != nil {
+		return err
+	}
+	if fb, ok := lb.buffer.(*FileBuffer); ok {
+		e.watchFile(fb.path)
+		if fb.HasSwapFile() {
+			e.promptSwapFile(fb)
+		}
+	}
+	return nil
+}
+
+// showBuffers lists the buffers in the format of Vim's :ls. The flags are %
+// for the current buffer, # for the alternate one, a for buffers shown in a
+// window, h for hidden buffers and + for modified ones.
+func (e *Editor) showBuffers() {
+	var lines []string
+	for _, lb := range e.buffers.buffers {
+		flag, state, changed := ' ', ' ', ' '
+		line := lb.cursor.row
+		switch lb {
+		case e.buffers.current:
+			flag = '%'
+		case e.buffers.alternate:
+			flag = '#'
+		}
+		if ws := e.windowsShowing(lb.buffer); len(ws) > 0 {
+			w := ws[0]
+			if lb == e.buffers.current {
+				w = e.window
+			}
+			state, line = 'a', w.CurrentPosition().row
+		} else if lb.loaded {
+			state = 'h'
+		}
+		if modified(lb.buffer) {
+			changed = '+'
+		}
+		lines = append(lines, fmt.Sprintf("%3d %c%c %c %-30q line %d", lb.number, flag, state, changed, lb.name(), line))
+	}
+	e.message = strings.Join(lines, "\n")
+}
+
+// switchBuffer shows the buffer with a number or name in the main window
+func (e *Editor) switchBuffer(cmd command.SwitchBuffer) error {
+	if cmd.Number == 0 && cmd.Name == "" {
+		return nil
+	}
+	lb, err := e.buffers.lookup(cmd.Number, cmd.Name)
+	if err != nil {
+		return err
+	}
+	return e.showBuffer(lb)
+}
+
+// switchBufferRelative shows a buffer before or after the current one in
+// the buffer list
+func (e *Editor) switchBufferRelative(delta int) error {
+	n := len(e.buffers.buffers)
+	if n == 0 {
+		return nil
+	}
+	i := e.buffers.index(e.buffers.current)
+	return e.showBuffer(e.buffers.buffers[((i+delta)%n+n)%n])
+}
+
+// alternateBuffer shows the buffer that was shown before the current one, or
+// the buffer with a number if it isn't 0
+func (e *Editor) alternateBuffer(number int) error {
+	lb := e.buffers.alternate
+	if number != 0 {
+		var err error
+		if lb, err = e.buffers.lookup(number, ""); err != nil {
+			e.message = err.Error()
+			return nil
+		}
+	}
+	if lb == nil {
+		e.message = "E23: No alternate file"
+		return nil
+	}
+	return e.showBuffer(lb)
+}
+
+// deleteBuffer removes a buffer from the buffer list and closes it, along
+// with the windows showing it. If the last window showed it the alternate
+// buffer is shown instead, or the next one in the list, or an empty buffer
+// if it was the last.
+func (e *Editor) deleteBuffer(cmd command.DeleteBuffer) error {
+	lb := e.buffers.current
+	if cmd.Number != 0 || cmd.Name != "" {
+		var err error
+		if lb, err = e.buffers.lookup(cmd.Number, cmd.Name); err != nil {
+			return err
+		}
+	}
+	if lb == nil {
+		return nil
+	}
+	if !cmd.Force && modified(lb.buffer) {
+		return fmt.Errorf("E89: No write since last change for buffer %d (add ! to override)", lb.number)
+	}
+
+	for _, w := range e.windowsShowing(lb.buffer) {
+		if e.windowLayout().statusLines() {
+			e.closeWindow(w)
+		}
+	}
+	shown := lb == e.buffers.current
+	i := e.buffers.index(lb)
+	e.buffers.remove(lb)
+	if shown {
+		next := e.buffers.alternate
+		switch {
+		case next != nil:
+		case len(e.buffers.buffers) == 0:
+			next = e.buffers.add(NewMemoryBuffer(e.Logger))
+			next.loaded = true
+		default:
+			next = e.buffers.buffers[min(i, len(e.buffers.buffers)-1)]
+		}
+		e.buffers.alternate = nil
+		if err := e.showBuffer(next); err != nil {
+			return err
+		}
+	}
+	if fb, ok := lb.buffer.(*FileBuffer); ok && e.watcher != nil {
+		e.watcher.Remove(fb.path)
+	}
+	return lb.buffer.Close()
+}
+
+// closeBuffers closes every buffer in the buffer list
+func (e *Editor) closeBuffers() error {
+	var errs []error
+	for _, lb := range e.buffers.buffers {
+		errs = append(errs, lb.buffer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// modifiedBuffer returns a buffer other than the one in the main window that
+// has unsaved changes, or nil
+func (e *Editor) modifiedBuffer() *listedBuffer {
+	for _, lb := range e.buffers.buffers {
+		if lb.buffer != e.window.buffer && modified(lb.buffer) {
+			return lb
+		}
+	}
+	return nil
+}
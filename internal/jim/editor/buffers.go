@@ -2,15 +2,17 @@ package editor
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"strings"
-)
+	"time"
 
-const (
-	MaxLineLength = 10 * 1024 * 1024
+	"github.com/jstotz/jim/internal/jim/charset"
 )
 
 type Buffer interface {
@@ -22,76 +24,162 @@ type Buffer interface {
 	Save() (written int, err error)
 	Clear()
 	LinesInRange(lineRange LineRange) []*Line
+	LineCount() int
+	Offset(position Point) int
+	PointAt(offset int) Point
+	Slice(start int, end int) string
+	UndoTree() *UndoTree
+	Marks() *Marks
+	Options() *BufferOptions
 	InsertText(position Point, text string) error
 	DeleteText(position Point, length int) error
 }
 
 type MemoryBuffer struct {
-	logger *slog.Logger
-	lines  []*Line
+	logger  *slog.Logger
+	text    *pieceTable
+	history *UndoTree
+	marks   Marks
+	options BufferOptions
 }
 
 func (mb *MemoryBuffer) LinesInRange(lr LineRange) []*Line {
-	return mb.lines[lr.start-1 : lr.end]
+	start := lr.start
+	if start < 1 {
+		start = 1
+	}
+	contents := mb.text.Lines(int(start-1), int(lr.end-start+1))
+	lines := make([]*Line, len(contents))
+	for i, content := range contents {
+		lines[i] = &Line{content: content, number: start + int64(i)}
+	}
+	return lines
+}
+
+func (mb *MemoryBuffer) LineCount() int {
+	return mb.text.LineCount()
+}
+
+// Offset converts a point to a byte offset into the buffer, clamping the
+// column to the bounds of the line. Newlines count as a single byte.
+func (mb *MemoryBuffer) Offset(p Point) int {
+	if !mb.text.HasLine(p.RowIndex()) {
+		return mb.text.Len()
+	}
+	start := mb.text.LineStart(p.RowIndex())
+	end := mb.text.LineEnd(p.RowIndex())
+	offset := start + p.ColumnIndex()
+	if offset < start {
+		return start
+	}
+	if offset > end {
+		return end
+	}
+	return offset
+}
+
+// PointAt converts a byte offset into the buffer to a point
+func (mb *MemoryBuffer) PointAt(offset int) Point {
+	line, column := mb.text.Position(offset)
+	return Point{row: line + 1, column: column + 1}
+}
+
+// Slice returns the text between the given byte offsets
+func (mb *MemoryBuffer) Slice(start int, end int) string {
+	return mb.text.Slice(max(start, 0), end)
+}
+
+func (mb *MemoryBuffer) UndoTree() *UndoTree {
+	return mb.history
+}
+
+func (mb *MemoryBuffer) Marks() *Marks {
+	return &mb.marks
 }
 
+// InsertText inserts text at the given position. Newlines in text split the
+// line they are inserted into.
 func (mb *MemoryBuffer) InsertText(p Point, text string) error {
-	line := mb.lines[p.RowIndex()]
-	line.content = line.content[:p.ColumnIndex()] + text + line.content[p.ColumnIndex():]
+	offset := mb.Offset(p)
+	mb.text.Insert(offset, text)
+	mb.marks.inserted(offset, len(text))
 	return nil
 }
 
+// DeleteText deletes length bytes forward from the given position, or
+// backward if length is negative. Deleting a newline joins the lines it
+// separated.
 func (mb *MemoryBuffer) DeleteText(p Point, length int) error {
 	if length == 0 {
 		return nil
 	}
 
-	line := mb.lines[p.RowIndex()]
+	start, end := mb.deleteRange(p, length)
+	if len(mb.marks.all) > 0 {
+		mb.marks.deleted(start, mb.text.Slice(start, end), end == mb.text.Len())
+	}
+	mb.text.Delete(start, end-start)
+	return nil
+}
 
+// deleteRange returns the byte offsets of the text deleted by DeleteText
+func (mb *MemoryBuffer) deleteRange(p Point, length int) (start int, end int) {
+	start = mb.Offset(p)
+	end = start + length
 	if length < 0 {
-		line.content = line.content[:length+p.ColumnIndex()] + line.content[p.ColumnIndex():]
-		return nil
+		start, end = end, start
 	}
-
-	line.content = line.content[:p.ColumnIndex()] + line.content[length+p.ColumnIndex():]
-	return nil
+	return max(start, 0), min(end, mb.text.Len())
 }
 
 func (mb *MemoryBuffer) Clear() {
-	mb.lines = []*Line{{}}
+	mb.text = newPieceTable(nil)
+	mb.history = NewUndoTree()
+	mb.marks.Clear()
+}
+
+func (mb *MemoryBuffer) Options() *BufferOptions {
+	return &mb.options
 }
 
+// String returns the buffer contents with the line endings of its file format
 func (mb *MemoryBuffer) String() string {
-	var sb strings.Builder
-	for _, line := range mb.lines {
-		sb.WriteString(line.content + "\n")
+	ending := mb.options.FileFormat.lineEnding()
+	s := mb.text.String()
+	if ending != "\n" {
+		s = strings.ReplaceAll(s, "\n", ending)
+	}
+	if mb.options.EndOfLine {
+		s += ending
 	}
-	return sb.String()
+	return s
 }
 
 func (mb *MemoryBuffer) Write(p []byte) (n int, err error) {
 	panic("not implemented. use ReadFrom")
 }
 
+// ReadFrom replaces the contents of the buffer with everything read from r
 func (mb *MemoryBuffer) ReadFrom(r io.Reader) (n int64, err error) {
-	// TODO: refactor to use a bufio reader
-	scanner := bufio.NewScanner(r)
-	buf := make([]byte, 0, MaxLineLength)
-	scanner.Buffer(buf, MaxLineLength)
-	var totalRead int64
-	lineNumber := int64(1)
-
-	for scanner.Scan() {
-		content := scanner.Text()
-		mb.lines = append(mb.lines, &Line{content: content, number: lineNumber})
-		lineNumber += 1
-		totalRead += int64(len(scanner.Bytes()))
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), fmt.Errorf("memory buffer read: %w", err)
 	}
-
-	if err := scanner.Err(); err != nil {
-		return totalRead, fmt.Errorf("memory buffer read: %w", err)
+	n = int64(len(data))
+
+	// Lines are stored separated by plain newlines. The original line endings
+	// and whether the last line was terminated are restored when writing. An
+	// empty file gets a final newline once it has any lines, as in Vim.
+	mb.options.FileFormat = detectFileFormat(data)
+	if mb.options.FileFormat == FileFormatDOS {
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
 	}
-	return
+	mb.options.EndOfLine = len(data) == 0 || bytes.HasSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	mb.text = newPieceTable(data)
+	mb.marks.Clear()
+	return n, nil
 }
 
 func (MemoryBuffer) Close() error {
@@ -109,11 +197,54 @@ func (MemoryBuffer) Save() (written int, err error) {
 	return 0, fmt.Errorf("unable to save a memory buffer")
 }
 
+// FileBufferOptions controls how a FileBuffer is persisted
+type FileBufferOptions struct {
+	// Backup keeps a copy of the previous file contents at path~ when saving
+	Backup bool
+	// SwapFile journals unsaved edits to a swap file so they can be recovered
+	SwapFile bool
+	// LargeFileSize is the size in bytes from which files are paged in from
+	// disk on demand instead of being read into memory. Large files are
+	// assumed to be UTF-8 and don't have swap or undo files. Zero disables
+	// large file handling.
+	LargeFileSize int64
+}
+
 type FileBuffer struct {
-	mbuf   *MemoryBuffer
-	logger *slog.Logger
-	path   string
-	file   *os.File
+	mbuf    *MemoryBuffer
+	logger  *slog.Logger
+	path    string
+	options FileBufferOptions
+	// hash is the hash of the file contents when last loaded or saved
+	hash string
+	// disk is the state of the file on disk when last loaded or saved
+	disk     diskState
+	swap     *swapFile
+	readOnly bool
+	// large is the source the buffer is paged in from if the file is large
+	large *fileSource
+	// saved is the undo state the buffer was in when last loaded or saved
+	saved *undoState
+}
+
+// ErrChangedOnDisk is returned when saving a file that was modified on disk
+// since it was loaded or last saved
+var ErrChangedOnDisk = errors.New("file changed on disk since it was read")
+
+// diskState is the modification time and size of a file on disk, used to
+// cheaply tell if it may have changed
+type diskState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+func statDisk(path string) diskState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return diskState{}
+	}
+	return diskState{exists: true, modTime: info.ModTime(), size: info.Size()}
 }
 
 func (fb *FileBuffer) String() string {
@@ -132,12 +263,116 @@ func (fb *FileBuffer) LinesInRange(lineRange LineRange) []*Line {
 	return fb.mbuf.LinesInRange(lineRange)
 }
 
+func (fb *FileBuffer) LineCount() int {
+	return fb.mbuf.LineCount()
+}
+
+func (fb *FileBuffer) Offset(position Point) int {
+	return fb.mbuf.Offset(position)
+}
+
+func (fb *FileBuffer) PointAt(offset int) Point {
+	return fb.mbuf.PointAt(offset)
+}
+
+func (fb *FileBuffer) Slice(start int, end int) string {
+	return fb.mbuf.Slice(start, end)
+}
+
+func (fb *FileBuffer) UndoTree() *UndoTree {
+	return fb.mbuf.UndoTree()
+}
+
+func (fb *FileBuffer) Marks() *Marks {
+	return fb.mbuf.Marks()
+}
+
+func (fb *FileBuffer) Options() *BufferOptions {
+	return fb.mbuf.Options()
+}
+
 func (fb *FileBuffer) InsertText(position Point, text string) error {
-	return fb.mbuf.InsertText(position, text)
+	offset := fb.mbuf.Offset(position)
+	if err := fb.mbuf.InsertText(position, text); err != nil {
+		return err
+	}
+	fb.journal(swapEdit{Offset: offset, Insert: text})
+	return nil
 }
 
 func (fb *FileBuffer) DeleteText(position Point, length int) error {
-	return fb.mbuf.DeleteText(position, length)
+	start, end := fb.mbuf.deleteRange(position, length)
+	if err := fb.mbuf.DeleteText(position, length); err != nil {
+		return err
+	}
+	fb.journal(swapEdit{Offset: start, Delete: end - start})
+	return nil
+}
+
+func (fb *FileBuffer) journal(e swapEdit) {
+	if fb.swap != nil {
+		fb.swap.record(e)
+	}
+}
+
+// SyncSwapFile writes any edits made since the last sync to the swap file
+func (fb *FileBuffer) SyncSwapFile() error {
+	if fb.swap == nil {
+		return nil
+	}
+	return fb.swap.sync()
+}
+
+// HasSwapFile reports whether a swap file, possibly left behind by a crash,
+// exists for the file
+func (fb *FileBuffer) HasSwapFile() bool {
+	return swapFileExists(fb.path)
+}
+
+// Recover replays the edits journaled in the file's swap file on top of the
+// loaded contents. The recovered edits are a single undoable change.
+func (fb *FileBuffer) Recover() error {
+	header, edits, err := readSwapFile(fb.path)
+	if err != nil {
+		return err
+	}
+	if header.Hash != fb.hash {
+		return fmt.Errorf("swap file for %s doesn't match the file on disk", fb.path)
+	}
+
+	history := fb.mbuf.history
+	history.BeginGroup()
+	defer history.EndGroup()
+	for _, e := range edits {
+		start := e.Offset
+		deleted := fb.mbuf.Slice(start, start+e.Delete)
+		if err := e.apply(fb); err != nil {
+			return fmt.Errorf("recover %s: %w", fb.path, err)
+		}
+		history.Record(change{offset: start, deleted: deleted, inserted: e.Insert}, fb.PointAt(start))
+	}
+
+	// Take over the swap file, journaling the recovered edits again
+	return fb.SyncSwapFile()
+}
+
+// DeleteSwapFile removes an existing swap file for the file
+func (fb *FileBuffer) DeleteSwapFile() error {
+	if err := os.Remove(swapFilePath(fb.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete swap file: %w", err)
+	}
+	return nil
+}
+
+// SetReadOnly prevents the buffer from being saved. Read-only buffers don't
+// write a swap file.
+func (fb *FileBuffer) SetReadOnly(readOnly bool) {
+	fb.readOnly = readOnly
+	if readOnly || fb.large != nil {
+		fb.swap = nil
+	} else if fb.options.SwapFile {
+		fb.swap = newSwapFile(fb.path, fb.hash)
+	}
 }
 
 func (fb *FileBuffer) Clear() {
@@ -145,73 +380,248 @@ func (fb *FileBuffer) Clear() {
 }
 
 func (fb *FileBuffer) Load() error {
-	f, err := os.OpenFile(fb.path, os.O_RDWR, 0666)
-	if os.IsNotExist(err) {
+	if err := fb.closeLarge(); err != nil {
+		return err
+	}
+	info, err := os.Stat(fb.path)
+	if errors.Is(err, fs.ErrNotExist) {
 		return nil
 	}
+	if err != nil {
+		return fmt.Errorf("load file buffer: %w", err)
+	}
+	if fb.options.LargeFileSize > 0 && info.Size() >= fb.options.LargeFileSize {
+		return fb.loadLarge()
+	}
 
+	content, err := os.ReadFile(fb.path)
 	if err != nil {
 		return fmt.Errorf("load file buffer: %w", err)
 	}
 
-	fb.file = f
+	enc, bom := charset.Detect(content)
 	fb.mbuf = NewMemoryBuffer(fb.logger)
-
-	if _, err := io.Copy(fb.mbuf, fb.file); err != nil {
+	if _, err := fb.mbuf.ReadFrom(bytes.NewReader(charset.Decode(content, enc, bom))); err != nil {
 		return err
 	}
+	fb.mbuf.options.FileEncoding = enc
+	fb.mbuf.options.BOM = bom
+	fb.hash = contentHash(content)
+	fb.disk = statDisk(fb.path)
+	fb.SetReadOnly(fb.readOnly)
+
+	// Undo history is only usable if the file hasn't changed since it was saved
+	history, err := readUndoFile(fb.path, fb.hash)
+	if err != nil {
+		fb.logger.Warn("Discarding undo history", "path", fb.path, "err", err)
+	}
+	if history != nil {
+		fb.mbuf.history = history
+	}
+	fb.saved = fb.mbuf.history.current
 
 	return nil
 }
 
-func (fb *FileBuffer) ensureFile() error {
-	if fb.file != nil {
+// loadLarge opens the file without reading it into memory. Lines are indexed
+// and read as they are displayed.
+func (fb *FileBuffer) loadLarge() error {
+	fb.mbuf = NewMemoryBuffer(fb.logger)
+	src, err := loadLargeFile(fb.path, fb.mbuf)
+	if err != nil {
+		return fmt.Errorf("load file buffer: %w", err)
+	}
+	fb.large = src
+	fb.hash = ""
+	fb.disk = statDisk(fb.path)
+	fb.saved = fb.mbuf.history.current
+	fb.SetReadOnly(fb.readOnly)
+	return nil
+}
+
+func (fb *FileBuffer) closeLarge() error {
+	if fb.large == nil {
 		return nil
 	}
-	f, err := os.Create(fb.path)
-	if err != nil {
-		return fmt.Errorf("file buffer: %w", err)
+	err := fb.large.Close()
+	fb.large = nil
+	return err
+}
+
+// Reload discards the buffer contents and loads the file again
+func (fb *FileBuffer) Reload() error {
+	if fb.swap != nil {
+		if err := fb.swap.remove(); err != nil {
+			return err
+		}
+	}
+	return fb.Load()
+}
+
+// SetPath changes the file the buffer is saved to. Its swap file moves to
+// the new path.
+func (fb *FileBuffer) SetPath(path string) error {
+	if fb.swap != nil {
+		if err := fb.swap.remove(); err != nil {
+			return err
+		}
 	}
-	fb.file = f
+	fb.path = path
+	fb.disk = statDisk(path)
+	fb.SetReadOnly(fb.readOnly)
 	return nil
 }
 
+// Modified reports whether the buffer has changes that haven't been saved
+func (fb *FileBuffer) Modified() bool {
+	return fb.mbuf.history.current != fb.saved
+}
+
+// AcknowledgeDiskChange keeps the buffer contents after the file changed on
+// disk, so the change is no longer reported and saving overwrites it
+func (fb *FileBuffer) AcknowledgeDiskChange() {
+	fb.disk = statDisk(fb.path)
+}
+
+// ChangedOnDisk reports whether the file on disk was changed by something
+// else since it was loaded or last saved. The file is only read to compare
+// hashes when its modification time or size changed.
+func (fb *FileBuffer) ChangedOnDisk() (bool, error) {
+	disk := statDisk(fb.path)
+	if disk == fb.disk {
+		return false, nil
+	}
+	// Large files aren't hashed, so any change to their size or time counts
+	if fb.large != nil {
+		return true, nil
+	}
+	content, err := os.ReadFile(fb.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("check %s: %w", fb.path, err)
+	}
+	if contentHash(content) != fb.hash {
+		return true, nil
+	}
+	// Touched without changing the contents
+	fb.disk = disk
+	return false, nil
+}
+
+// Save writes the buffer to its file atomically, leaving the original file
+// untouched if anything fails. It refuses to overwrite the file if it was
+// changed on disk, returning ErrChangedOnDisk.
 func (fb *FileBuffer) Save() (written int, err error) {
-	f := fb.file
-	if err := fb.ensureFile(); err != nil {
+	changed, err := fb.ChangedOnDisk()
+	if err != nil {
 		return 0, err
 	}
+	// Writing a file that was deleted can't lose anything
+	if changed && statDisk(fb.path).exists {
+		return 0, fmt.Errorf("save %s: %w", fb.path, ErrChangedOnDisk)
+	}
+	return fb.Overwrite()
+}
 
-	// TODO: make this safer (backups? atomic writes?)
-	if err := f.Truncate(0); err != nil {
-		return 0, fmt.Errorf("save truncate: %w", err)
+// Overwrite saves the buffer even if the file was changed on disk
+func (fb *FileBuffer) Overwrite() (written int, err error) {
+	if fb.readOnly {
+		return 0, fmt.Errorf("save %s: buffer is read-only", fb.path)
 	}
-	if _, err := f.Seek(0, 0); err != nil {
-		return 0, fmt.Errorf("save seek: %w", err)
+
+	if fb.large != nil {
+		return fb.saveLarge()
 	}
 
-	// TODO: write incrementally
-	return f.WriteString(fb.mbuf.String())
+	content, err := charset.Encode([]byte(fb.mbuf.String()), fb.mbuf.options.FileEncoding, fb.mbuf.options.BOM)
+	if err != nil {
+		return 0, fmt.Errorf("save %s: %w", fb.path, err)
+	}
+	write := func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	}
+	if err := writeFileAtomic(fb.path, write, fb.options.Backup); err != nil {
+		return 0, fmt.Errorf("save %s: %w", fb.path, err)
+	}
+	fb.hash = contentHash(content)
+	fb.disk = statDisk(fb.path)
+	fb.saved = fb.mbuf.history.current
+
+	if err := writeUndoFile(fb.path, fb.hash, fb.mbuf.history); err != nil {
+		fb.logger.Warn("Failed to save undo history", "path", fb.path, "err", err)
+	}
+	if fb.swap != nil {
+		if err := fb.swap.reset(fb.hash); err != nil {
+			fb.logger.Warn("Failed to reset swap file", "path", fb.path, "err", err)
+		}
+	}
+	return len(content), nil
+}
+
+// saveLarge streams a large file buffer to disk a chunk at a time instead of
+// building the whole file in memory
+func (fb *FileBuffer) saveLarge() (written int, err error) {
+	opts := fb.mbuf.options
+	if opts.FileEncoding != charset.UTF8 || opts.BOM {
+		return 0, fmt.Errorf("save %s: large files can only be saved as utf-8", fb.path)
+	}
+	write := func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		var lw io.Writer = bw
+		if opts.FileFormat != FileFormatUnix {
+			lw = &lineEndingWriter{w: bw, ending: opts.FileFormat.lineEnding()}
+		}
+		n, err := fb.mbuf.text.WriteTo(lw)
+		written = int(n)
+		if err != nil {
+			return err
+		}
+		if opts.EndOfLine {
+			n, err := io.WriteString(lw, "\n")
+			written += n
+			if err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+	if err := writeFileAtomic(fb.path, write, fb.options.Backup); err != nil {
+		return 0, fmt.Errorf("save %s: %w", fb.path, err)
+	}
+	fb.disk = statDisk(fb.path)
+	fb.saved = fb.mbuf.history.current
+	return written, nil
 }
 
+// Close removes the buffer's swap file. Unsaved changes are discarded.
 func (fb *FileBuffer) Close() error {
-	if fb.file == nil {
+	if err := fb.closeLarge(); err != nil {
+		return err
+	}
+	if fb.swap == nil {
 		return nil
 	}
-	return fb.file.Close()
+	return fb.swap.remove()
 }
 
-func NewFileBuffer(path string, logger *slog.Logger) *FileBuffer {
-	return &FileBuffer{
-		logger: logger,
-		mbuf:   NewMemoryBuffer(logger),
-		path:   path,
+func NewFileBuffer(path string, options FileBufferOptions, logger *slog.Logger) *FileBuffer {
+	fb := &FileBuffer{
+		logger:  logger,
+		mbuf:    NewMemoryBuffer(logger),
+		path:    path,
+		options: options,
+		hash:    contentHash(nil),
 	}
+	fb.saved = fb.mbuf.history.current
+	fb.SetReadOnly(false)
+	return fb
 }
 
 func NewMemoryBuffer(logger *slog.Logger) *MemoryBuffer {
 	return &MemoryBuffer{
-		logger: logger,
-		lines:  []*Line{},
+		logger:  logger,
+		text:    newPieceTable(nil),
+		history: NewUndoTree(),
+		options: defaultBufferOptions(),
 	}
 }
@@ -0,0 +1,39 @@
+package editor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryBufferReadFromEndOfLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		insert    string
+		endOfLine bool
+		want      string
+	}{
+		{"empty file", "", "foo", true, "foo\n"},
+		{"terminated", "a\n", "", true, "a\n"},
+		{"unterminated", "a", "", false, "a"},
+		{"dos", "a\r\n", "", true, "a\r\n"},
+		{"dos unterminated", "a\r\nb", "", false, "a\r\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBuffer(nil)
+			if _, err := b.ReadFrom(strings.NewReader(tt.data)); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.Options().EndOfLine; got != tt.endOfLine {
+				t.Errorf("EndOfLine = %v, want %v", got, tt.endOfLine)
+			}
+			if err := b.InsertText(Point{1, 1}, tt.insert); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,18 +1,23 @@
 package editor
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
 	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/jstotz/jim/internal/jim/clipboard"
 	"github.com/jstotz/jim/internal/jim/command"
 	"github.com/jstotz/jim/internal/jim/config"
 	"github.com/jstotz/jim/internal/jim/input"
+	"github.com/jstotz/jim/internal/jim/keys"
 	"github.com/jstotz/jim/internal/jim/modes"
+	"github.com/jstotz/jim/internal/jim/registers"
+	"github.com/jstotz/jim/internal/jim/watcher"
 	"github.com/muesli/termenv"
 	lua "github.com/yuin/gopher-lua"
 	"golang.org/x/term"
@@ -28,14 +33,40 @@ type Editor struct {
 	Logger        *slog.Logger
 	tty           *os.File
 	exitChan      chan error
-	keypressChan  chan rune
+	keypressChan  chan keys.Key
 	input         io.Reader
 	output        *termenv.Output
 	window        *Window
+	layout        *windowLayout
+	buffers       bufferList
 	prevTermState *term.State
 	commandWindow *Window
 	luaState      *lua.LState
 	inputHandler  *input.Handler
+	config        config.Config
+	// message is shown to the user until the next keypress
+	message string
+	prompt  *prompt
+	// operator is the operator waiting for a motion in operator-pending mode
+	operator    command.BeginOperator
+	blockInsert *blockInsert
+	registers   *registers.Store
+	// registerName is the register selected with "x for the next command
+	registerName rune
+	// inserted is the text typed in the current insert mode session
+	inserted string
+	changes  changeRecorder
+	macro    macroState
+	search   searchState
+	// lastSubstitute is the last :s, which :s without arguments repeats
+	lastSubstitute *command.Substitute
+	// inGlobal is set while :global runs its command
+	inGlobal bool
+	// commandPrompt is the character the command line starts with: : for
+	// commands, or / and ? for searches
+	commandPrompt rune
+	watcher       *watcher.Watcher
+	eventHandlers map[string][]*lua.LFunction
 }
 
 func NewEditor(inputFile *os.File, outputFile *os.File, log *os.File) *Editor {
@@ -49,19 +80,23 @@ func NewEditor(inputFile *os.File, outputFile *os.File, log *os.File) *Editor {
 	}
 
 	logger := slog.New(slog.NewTextHandler(log, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	// TODO: Allow config customization
+	cfg := config.DefaultConfig()
 
 	return &Editor{
 		Logger:        logger,
 		mode:          modes.ModeNormal,
 		tty:           tty,
 		exitChan:      make(chan error, 1),
-		keypressChan:  make(chan rune, 1),
+		keypressChan:  make(chan keys.Key, 1),
 		input:         inputFile,
 		output:        termenv.NewOutput(outputFile),
 		prevTermState: nil,
 		luaState:      lua.NewState(),
-		// TODO: Allow config customization
-		inputHandler: input.NewHandler(config.DefaultConfig()),
+		inputHandler:  input.NewHandler(cfg),
+		config:        cfg,
+		registers:     registers.NewStore(),
+		registerName:  registers.Unnamed,
 	}
 }
 
@@ -76,38 +111,109 @@ func (e *Editor) FocusedWindow() *Window {
 	return e.window
 }
 
-func (e *Editor) Setup() error {
+func (e *Editor) Setup() (err error) {
 	prevTermState, err := term.MakeRaw(int(e.tty.Fd()))
 	e.prevTermState = prevTermState
 	if err != nil {
 		return fmt.Errorf("terminal raw mode: %w", err)
 	}
+	// Start restores the terminal when the editor exits, but it never runs
+	// if setup fails
+	defer func() {
+		if err != nil {
+			if restoreErr := term.Restore(int(e.tty.Fd()), e.prevTermState); restoreErr != nil {
+				log.Printf("error restoring terminal state: %v", restoreErr)
+			}
+		}
+	}()
 	width, height, err := e.GetSize()
 	if err != nil {
 		return err
 	}
 	e.window = NewWindow(nil, 0, 0, width, height-1, e.Logger)
+	e.layout = newWindowLayout(e.window, width, height-1)
 
 	e.commandWindow = NewWindow(NewMemoryBuffer(e.Logger), height-1, 1, width, 1, e.Logger)
 
+	// Without a watcher changes on disk are still noticed by :checktime and on save
+	if e.watcher, err = watcher.New(); err != nil {
+		e.Logger.Warn("file watcher unavailable", "err", err)
+	}
+
+	provider, err := clipboard.New(e.config.Clipboard, e.output)
+	if err != nil {
+		return err
+	}
+	e.registers.SetClipboard(provider)
+
 	return nil
 }
 
+func (e *Editor) fileBufferOptions() FileBufferOptions {
+	return FileBufferOptions{
+		Backup:        e.config.Backup,
+		SwapFile:      e.config.SwapFile,
+		LargeFileSize: e.config.LargeFileSize,
+	}
+}
+
+// LoadFile opens the file at path in the main window, adding it to the
+// buffer list unless it's already there. If a swap file was left behind for
+// it the user is asked what to do with it.
 func (e *Editor) LoadFile(path string) error {
-	fb := NewFileBuffer(path, e.Logger)
-	return e.FocusedWindow().LoadBuffer(fb)
+	lb := e.buffers.find(path)
+	if lb == nil {
+		lb = e.buffers.add(NewFileBuffer(path, e.fileBufferOptions(), e.Logger))
+	}
+	return e.showBuffer(lb)
 }
 
-func (e *Editor) readInput() {
-	r := bufio.NewReader(e.input)
-	for {
-		c, _, err := r.ReadRune()
-		if err != nil {
-			e.exit(err)
-			return
-		}
-		e.keypressChan <- c
+func (e *Editor) watchFile(path string) {
+	if e.watcher == nil {
+		return
 	}
+	if err := e.watcher.Add(path); err != nil {
+		e.Logger.Warn("unable to watch file", "path", path, "err", err)
+	}
+}
+
+// RecoverFile opens the file at path in the main window and recovers the
+// unsaved changes from its swap file
+func (e *Editor) RecoverFile(path string) error {
+	fb := NewFileBuffer(path, e.fileBufferOptions(), e.Logger)
+	if err := fb.Load(); err != nil {
+		return err
+	}
+	lb := e.buffers.add(fb)
+	lb.loaded = true
+	if err := e.showBuffer(lb); err != nil {
+		return err
+	}
+	e.watchFile(path)
+	if !fb.HasSwapFile() {
+		return fmt.Errorf("no swap file found for %s", path)
+	}
+	return fb.Recover()
+}
+
+func (e *Editor) promptSwapFile(fb *FileBuffer) {
+	message := fmt.Sprintf("Found swap file %s", swapFilePath(fb.path))
+	if header, _, err := readSwapFile(fb.path); err == nil {
+		message += fmt.Sprintf(" (pid %d)", header.PID)
+	}
+	e.showPrompt(message+": [R]ecover, [D]elete, [O]pen read-only", map[rune]func() error{
+		'r': fb.Recover,
+		'd': fb.DeleteSwapFile,
+		'o': func() error {
+			fb.SetReadOnly(true)
+			return nil
+		},
+	})
+}
+
+func (e *Editor) readInput() {
+	d := keys.NewDecoder(e.input, e.config.EscTimeout)
+	e.exit(d.Run(e.keypressChan))
 }
 
 func (e *Editor) updateCursor() {
@@ -118,7 +224,7 @@ func (e *Editor) updateCursor() {
 
 func (e *Editor) setCursorStyle() {
 	switch e.mode {
-	case modes.ModeNormal:
+	case modes.ModeNormal, modes.ModeOperatorPending, modes.ModeVisual, modes.ModeVisualLine, modes.ModeVisualBlock:
 		e.mustWriteString(cursorStyleBlock)
 	case modes.ModeInsert, modes.ModeCommand:
 		e.mustWriteString(cursorStyleLine)
@@ -134,55 +240,221 @@ func (e *Editor) mustWriteString(s string) (written int) {
 	return written
 }
 
-func (e *Editor) handleKeypress(c rune) error {
-	e.Logger.Info("Handling keypress", "key", c)
-	cmd, err := e.inputHandler.HandleKeyPress(e.mode, c)
+func (e *Editor) handleKeypress(k keys.Key) error {
+	e.Logger.Info("Handling keypress", "key", k.String())
+	e.message = ""
+	if e.prompt != nil {
+		e.handlePromptKeypress(k)
+		return nil
+	}
+	e.recordKey(k)
+	cmd, err := e.inputHandler.HandleKeyPress(e.mode, k)
 	if err != nil {
 		return err
 	}
-	return e.runCommand(cmd)
-}
-
-func (e *Editor) parseCommand(expr string) (command.Command, error) {
-	if strings.HasPrefix(expr, "lua ") {
-		return command.EvalLua{Script: expr[4:]}, nil
+	if err := e.runCommand(cmd); err != nil {
+		return err
 	}
-	if expr == "w" {
-		return command.Save{}, nil
+	if e.searching() {
+		e.updateIncrementalSearch()
 	}
-	if expr == "q" {
-		return command.Exit{}, nil
+	// While recording a macro the key that starts recording stops it
+	if _, ok := e.inputHandler.Argument().(command.RecordMacro); ok && e.macro.recording != 0 {
+		e.inputHandler.Reset()
+		e.stopRecording()
 	}
-	return command.Noop{}, fmt.Errorf("invalid expression: %s", expr)
+	return nil
 }
 
 func (e *Editor) evalCommand(expr string) error {
-	cmd, err := e.parseCommand(expr)
-	if err != nil {
-		return err
-	}
-	return e.runCommand(cmd)
+	return e.runCommand(command.Ex{Line: expr, Column: 1})
 }
 
+// runCommand runs a command, recording the commands run for keypresses that
+// make up a change so that it can be repeated
 func (e *Editor) runCommand(cmd command.Command) error {
+	if e.changes.depth > 0 {
+		return e.execCommand(cmd)
+	}
+	mode := e.mode
+	e.changes.depth++
+	err := e.execCommand(cmd)
+	e.changes.depth--
+	e.recordChange(mode, cmd)
+	return err
+}
+
+func (e *Editor) execCommand(cmd command.Command) error {
 	w := e.FocusedWindow()
+	if e.mode == modes.ModeOperatorPending {
+		if target, count, ok := operatorTarget(cmd); ok {
+			return e.completeOperator(target, count)
+		}
+	}
 	switch cmd := cmd.(type) {
 	case command.Noop:
 		return nil
+	case command.Sequence:
+		for _, c := range cmd.Commands {
+			if err := e.runCommand(c); err != nil {
+				return err
+			}
+		}
+	case command.Repeat:
+		if c, ok := cmd.Command.(command.Countable); ok {
+			return e.runCommand(c.WithCount(cmd.Count))
+		}
+		if m, ok := cmd.Command.(command.Motion); ok {
+			e.moveCursor(m, cmd.Count)
+			return nil
+		}
+		if obj, ok := cmd.Command.(command.TextObject); ok && e.mode.IsVisual() {
+			return e.selectTextObject(obj, cmd.Count)
+		}
+		for i := 0; i < cmd.Count; i++ {
+			if err := e.runCommand(cmd.Command); err != nil {
+				return err
+			}
+		}
 	case command.Save:
-		return e.saveBuffer()
+		return e.saveBuffer(false)
 	case command.MoveCursorRelative:
 		e.FocusedWindow().MoveCursorRelative(cmd.DeltaRows, cmd.DeltaColumns)
+	case command.Motion:
+		e.moveCursor(cmd, 0)
+	case command.TextObject:
+		if e.mode.IsVisual() {
+			return e.selectTextObject(cmd, 0)
+		}
+	case command.BeginOperator:
+		if e.mode.IsVisual() {
+			return e.operateOnSelection(cmd.Operator)
+		}
+		e.operator = cmd
+		return e.activateMode(modes.ModeOperatorPending)
+	case command.SwapSelectionEnds:
+		w.SwapSelectionEnds()
+	case command.BlockInsert:
+		return e.beginBlockInsert(cmd.Append)
+	case command.ApplyOperator:
+		return e.applyOperator(cmd)
+	case command.SelectRegister:
+		if registers.Valid(cmd.Name) {
+			e.registerName = cmd.Name
+		}
+	case command.Put:
+		return e.put(cmd.Before, cmd.Count)
+	case command.InsertRegister:
+		r, err := e.registers.Get(cmd.Name)
+		if err != nil {
+			e.message = err.Error()
+			return nil
+		}
+		return e.runCommand(command.InsertText{Text: r.Text})
+	case command.RepeatChange:
+		return e.repeatChange(cmd.Count)
+	case command.RecordMacro:
+		e.startRecording(cmd.Name)
+	case command.PlayMacro:
+		return e.playMacro(cmd.Name, cmd.Count)
+	case command.StartSearch:
+		if e.mode == modes.ModeOperatorPending {
+			return e.startOperatorSearch(cmd.Backward)
+		}
+		return e.startSearch(cmd.Backward)
+	case command.Ex:
+		return e.evalEx(cmd)
+	case command.Substitute:
+		return e.substitute(cmd)
+	case command.DeleteLines:
+		return e.deleteLines(cmd)
+	case command.CopyLines:
+		return e.copyLines(cmd)
+	case command.Normal:
+		return e.normal(cmd)
+	case command.Global:
+		return e.global(cmd)
+	case command.SetMark:
+		if cmd.Name >= 'a' && cmd.Name <= 'z' {
+			e.window.buffer.Marks().Set(cmd.Name, e.window.buffer.Offset(e.window.CurrentPosition()))
+		}
+	case command.NoHighlight:
+		e.search.highlight = false
+		e.updateHighlight()
+	case command.ShowRegisters:
+		e.message = e.registers.List()
 	case command.DeleteText:
-		return w.DeleteText(w.CurrentPosition(), cmd.Length)
+		p := w.CurrentPosition()
+		length := runeBytes(w.buffer, w.buffer.Offset(p), cmd.Length)
+		if e.mode == modes.ModeInsert && length < 0 {
+			// Drop the deleted bytes from what was typed so the . register
+			// matches the text left behind
+			e.inserted = e.inserted[:max(len(e.inserted)+length, 0)]
+		}
+		return w.DeleteText(p, length)
 	case command.InsertText:
+		if e.mode == modes.ModeInsert {
+			e.inserted += cmd.Text
+		}
 		return w.InsertText(w.CurrentPosition(), cmd.Text)
+	case command.Undo:
+		return e.undo(e.window.buffer.UndoTree().Undo, "Already at oldest change")
+	case command.Redo:
+		return e.undo(e.window.buffer.UndoTree().Redo, "Already at newest change")
+	case command.UndoEarlier:
+		return e.undo(func(b Buffer) (Point, bool, error) {
+			return b.UndoTree().Earlier(b, cmd.Count)
+		}, "Already at oldest change")
+	case command.UndoLater:
+		return e.undo(func(b Buffer) (Point, bool, error) {
+			return b.UndoTree().Later(b, cmd.Count)
+		}, "Already at newest change")
+	case command.SetOption:
+		return e.setOption(cmd.Arg)
+	case command.CheckTime:
+		return e.checkTime()
+	case command.UndoList:
+		e.message = e.window.buffer.UndoTree().List()
 	case command.ActivateMode:
 		return e.activateMode(cmd.Mode)
 	case command.EvalCommandBuffer:
 		return e.evalCommandBuffer()
 	case command.EvalLua:
 		return e.evalLua(cmd.Script)
+	case command.Write:
+		return e.write(cmd)
+	case command.WriteAll:
+		return e.writeAll(cmd)
+	case command.SaveAs:
+		return e.saveAs(cmd)
+	case command.Edit:
+		return e.edit(cmd)
+	case command.Read:
+		return e.read(cmd)
+	case command.Quit:
+		return e.quit(cmd)
+	case command.ShowBuffers:
+		e.showBuffers()
+	case command.SwitchBuffer:
+		return e.switchBuffer(cmd)
+	case command.SwitchBufferRelative:
+		return e.switchBufferRelative(cmd.Delta)
+	case command.AlternateBuffer:
+		return e.alternateBuffer(cmd.Number)
+	case command.DeleteBuffer:
+		return e.deleteBuffer(cmd)
+	case command.SplitWindow:
+		return e.splitWindow(cmd)
+	case command.FocusWindow:
+		e.focusNeighbor(cmd.Direction)
+	case command.EqualizeWindows:
+		e.windowLayout().equalize()
+	case command.ResizeWindow:
+		e.windowLayout().resize(e.window, cmd.Vertical, cmd.Delta, cmd.Absolute)
+	case command.CloseWindow:
+		e.closeWindow(e.window)
+	case command.OnlyWindow:
+		e.onlyWindow()
 	case command.Exit:
 		e.exit(nil)
 	default:
@@ -191,19 +463,82 @@ func (e *Editor) runCommand(cmd command.Command) error {
 	return nil
 }
 
-func (e *Editor) saveBuffer() error {
-	written, err := e.window.buffer.Save()
-	e.Logger.Debug("Saved buffer", "written", written)
-	return err
+// undo moves through the undo history of the main window's buffer using fn,
+// showing msg if there was nowhere to move
+func (e *Editor) undo(fn func(b Buffer) (Point, bool, error), msg string) error {
+	p, ok, err := fn(e.window.buffer)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		e.message = msg
+		return nil
+	}
+	e.window.SetPosition(p)
+	return nil
+}
+
+// checkTime checks whether the file in the main window changed on disk. A
+// FileChangedShell handler decides what happens if there is one, otherwise
+// an unmodified buffer is reloaded and the user is asked about a modified one.
+func (e *Editor) checkTime() error {
+	fb, ok := e.window.buffer.(*FileBuffer)
+	if !ok || e.prompt != nil {
+		return nil
+	}
+	changed, err := fb.ChangedOnDisk()
+	if err != nil || !changed {
+		return err
+	}
+
+	if choice, ok := e.fireEvent(EventFileChangedShell, lua.LString(fb.path)); ok {
+		switch lua.LVAsString(choice) {
+		case "reload":
+			return e.reloadBuffer(fb)
+		case "ask":
+		default:
+			fb.AcknowledgeDiskChange()
+			return nil
+		}
+	}
+
+	if !fb.Modified() {
+		e.message = fmt.Sprintf("%q reloaded: file changed on disk", fb.path)
+		return e.reloadBuffer(fb)
+	}
+	e.showPrompt(fmt.Sprintf("W12: %q changed on disk and the buffer was changed too: [L]oad file, [O]K", fb.path), map[rune]func() error{
+		'l': func() error { return e.reloadBuffer(fb) },
+		'o': func() error {
+			fb.AcknowledgeDiskChange()
+			return nil
+		},
+	})
+	return nil
+}
+
+func (e *Editor) reloadBuffer(fb *FileBuffer) error {
+	p := e.window.CurrentPosition()
+	if err := fb.Reload(); err != nil {
+		return err
+	}
+	e.window.SetPosition(fb.PointAt(fb.Offset(p)))
+	return nil
 }
 
 func (e *Editor) evalCommandBuffer() error {
+	if e.searching() {
+		return e.evalSearch(bufferText(e.commandWindow.buffer))
+	}
 	expr := strings.TrimSpace(e.commandWindow.buffer.String())
+	if expr != "" {
+		e.registers.SetReadOnly(':', expr)
+	}
+	// Commands run in normal mode, on the main window
+	e.must(e.activateMode(modes.ModeNormal))
 	if err := e.evalCommand(expr); err != nil {
 		e.Logger.Error("eval command buffer error", "err", err)
+		e.message = err.Error()
 	}
-	e.commandWindow.Clear()
-	e.must(e.activateMode(modes.ModeNormal))
 	return nil
 }
 
@@ -217,14 +552,50 @@ func (e *Editor) evalLua(script string) error {
 }
 
 func (e *Editor) activateMode(mode modes.Mode) error {
+	// Activating the current visual mode again leaves it, like pressing v in
+	// visual mode
+	if mode.IsVisual() && mode == e.mode {
+		mode = modes.ModeNormal
+	}
+	if mode.IsVisual() {
+		e.window.StartSelection(selectionKinds[mode])
+	} else {
+		e.window.ClearSelection()
+	}
+	if mode == modes.ModeCommand {
+		e.commandPrompt = ':'
+	} else if e.searching() {
+		e.cancelSearch()
+	}
+
+	// Everything typed in a single insert mode session is undone as one step
+	if e.window.buffer != nil {
+		if mode == modes.ModeInsert {
+			e.window.buffer.UndoTree().BeginGroup()
+			e.inserted = ""
+		} else if e.mode == modes.ModeInsert {
+			e.registers.SetReadOnly('.', e.inserted)
+			if e.blockInsert != nil {
+				if err := e.finishBlockInsert(); err != nil {
+					return err
+				}
+			}
+			e.window.buffer.UndoTree().EndGroup()
+		}
+	}
 	e.mode = mode
 	e.commandWindow.Clear()
 	e.Logger.Debug("Activated mode", "mode", mode)
 	return nil
 }
 
+// exit stops the editor once the command being run finishes. Only the first
+// exit counts.
 func (e *Editor) exit(err error) {
-	e.exitChan <- err
+	select {
+	case e.exitChan <- err:
+	default:
+	}
 }
 
 func (e *Editor) Start() error {
@@ -234,18 +605,65 @@ func (e *Editor) Start() error {
 	NewAPIModule(e).Load()
 	defer e.luaState.Close()
 
+	swapTicker := time.NewTicker(e.config.UpdateTime)
+	defer swapTicker.Stop()
+
+	var fileChanges <-chan string
+	if e.watcher != nil {
+		fileChanges = e.watcher.Events()
+		defer e.watcher.Close()
+	}
+
+	// keyTimeout fires when the input handler has waited too long for the
+	// next key of a pending key binding
+	var keyTimeout <-chan time.Time
+
 	go e.readInput()
 	e.must(e.draw())
 	e.updateCursor()
 	for {
 		select {
-		case c := <-e.keypressChan:
-			e.must(e.handleKeypress(c))
+		case k := <-e.keypressChan:
+			e.must(e.handleKeypress(k))
+			keyTimeout = nil
+			if e.inputHandler.Pending() {
+				keyTimeout = time.After(e.config.TimeoutLen)
+			}
+			e.output.ClearScreen()
+			e.must(e.draw())
+			e.updateCursor()
+		case <-keyTimeout:
+			keyTimeout = nil
+			e.must(e.runCommand(e.inputHandler.Timeout(e.mode)))
+			e.output.ClearScreen()
+			e.must(e.draw())
+			e.updateCursor()
+		case <-swapTicker.C:
+			e.syncSwapFile()
+		case <-fileChanges:
+			e.must(e.checkTime())
 			e.output.ClearScreen()
 			e.must(e.draw())
 			e.updateCursor()
 		case err := <-e.exitChan:
-			return err
+			if err != nil {
+				// Keep the swap file so unsaved changes can be recovered
+				e.syncSwapFile()
+				return err
+			}
+			return e.closeBuffers()
+		}
+	}
+}
+
+func (e *Editor) syncSwapFile() {
+	for _, lb := range e.buffers.buffers {
+		fb, ok := lb.buffer.(*FileBuffer)
+		if !ok {
+			continue
+		}
+		if err := fb.SyncSwapFile(); err != nil {
+			e.Logger.Error("sync swap file error", "err", err)
 		}
 	}
 }
@@ -258,18 +676,55 @@ func (e *Editor) must(err error) {
 
 func (e *Editor) draw() error {
 	_, err := e.output.WriteString(strings.Join([]string{
-		e.window.Render(),
+		e.renderWindow(),
 		e.renderStatusLine(),
 	}, "\r\n"))
 	return err
 }
 
+// renderWindow renders the main window, covering its bottom lines with the
+// current message when it is too long to fit in the status line
+func (e *Editor) renderWindow() string {
+	layout := e.windowLayout()
+	var content string
+	if layout.statusLines() {
+		content = strings.Join(layout.render(e.window, e.windowStatus), "\r\n")
+	} else {
+		content = e.window.Render()
+	}
+	messageLines := strings.Split(e.message, "\n")
+	if len(messageLines) < 2 {
+		return content
+	}
+	lines := strings.Split(content, "\r\n")
+	for len(lines) < layout.height {
+		lines = append(lines, "")
+	}
+	overlay := max(len(lines)-len(messageLines), 0)
+	lines = append(lines[:overlay], messageLines[max(len(messageLines)-len(lines), 0):]...)
+	return strings.Join(lines, "\r\n")
+}
+
 func (e *Editor) renderStatusLine() string {
+	if e.prompt != nil {
+		return e.prompt.message
+	}
 	if e.mode == modes.ModeCommand {
 		content := e.commandWindow.Render()
-		return fmt.Sprintf(":%s", content)
+		return fmt.Sprintf("%c%s", e.commandPrompt, content)
+	}
+	if e.message != "" && !strings.Contains(e.message, "\n") {
+		return e.message
 	}
-	return fmt.Sprintf("[%s]", strings.ToUpper(e.mode.String()))
+	opts := e.window.buffer.Options()
+	status := fmt.Sprintf("[%s] %s %s", strings.ToUpper(e.mode.String()), opts.FileEncoding, opts.FileFormat)
+	if pending := e.inputHandler.PendingKeys(); pending != "" {
+		status += " " + pending
+	}
+	if e.macro.recording != 0 {
+		status += fmt.Sprintf(" recording @%c", e.macro.recording)
+	}
+	return status
 }
 
 func (e *Editor) cleanup() {
@@ -278,3 +733,23 @@ func (e *Editor) cleanup() {
 		log.Printf("error restoring terminal state: %v", err)
 	}
 }
+
+// runeBytes returns how many bytes the n characters after offset take up,
+// or the negative of how many the characters before it do if n is negative
+func runeBytes(b Buffer, offset, n int) int {
+	length := 0
+	if n >= 0 {
+		text := b.Slice(offset, offset+n*utf8.UTFMax)
+		for ; n > 0 && length < len(text); n-- {
+			_, size := utf8.DecodeRuneInString(text[length:])
+			length += size
+		}
+		return length
+	}
+	text := b.Slice(max(offset+n*utf8.UTFMax, 0), offset)
+	for ; n < 0 && length < len(text); n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:len(text)-length])
+		length += size
+	}
+	return -length
+}
@@ -0,0 +1,93 @@
+package editor
+
+import (
+	"testing"
+
+	"github.com/jstotz/jim/internal/jim/keys"
+)
+
+// newTestBuffer returns a memory buffer holding text
+func newTestBuffer(t *testing.T, text string) *MemoryBuffer {
+	t.Helper()
+	b := NewMemoryBuffer(nil)
+	if err := b.InsertText(Point{1, 1}, text); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newTestEditor returns an editor showing a buffer holding text, without a
+// terminal
+func newTestEditor(t *testing.T, text string) *Editor {
+	t.Helper()
+	e := NewEditor(nil, nil, nil)
+	b := newTestBuffer(t, text)
+	e.window = NewWindow(b, 0, 0, 80, 23, e.Logger)
+	e.commandWindow = NewWindow(NewMemoryBuffer(e.Logger), 23, 1, 80, 1, e.Logger)
+	lb := e.buffers.add(b)
+	lb.loaded = true
+	e.buffers.current = lb
+	return e
+}
+
+// typeKeys types keys written in key notation in normal mode
+func typeKeys(t *testing.T, e *Editor, notation string) {
+	t.Helper()
+	if err := e.typeNormal(keys.Parse(notation)); err != nil {
+		t.Fatalf("typing %s: %v", notation, err)
+	}
+}
+
+func TestBackspace(t *testing.T) {
+	tests := []struct {
+		text string
+		keys string
+		want string
+	}{
+		{"abc", "ix<BS><Esc>", "abc"},
+		{"abc", "ié<BS><Esc>", "abc"},
+		{"abc", "iéé<BS><Esc>", "éabc"},
+		{"héllo", "$i<BS><BS><BS><Esc>", "ho"},
+		{"日本", "$i<BS><Esc>", "本"},
+		{"a\nb", "ji<BS><Esc>", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keys, func(t *testing.T) {
+			e := newTestEditor(t, tt.text)
+			typeKeys(t, e, tt.keys)
+			if got := bufferText(e.window.buffer); got != tt.want {
+				t.Errorf("typing %s on %q gave %q, want %q", tt.keys, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertedRegister(t *testing.T) {
+	tests := []struct {
+		text string
+		keys string
+		want string
+		dot  string
+	}{
+		{"abc", "ixy<BS>z<Esc>", "xzabc", "xz"},
+		{"abc", "iéé<BS>q<Esc>", "éqabc", "éq"},
+		{"abc", "i日本<BS><BS><Esc>", "abc", ""},
+		{"abc", "$i<BS>x<Esc>", "axc", "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keys, func(t *testing.T) {
+			e := newTestEditor(t, tt.text)
+			typeKeys(t, e, tt.keys)
+			if got := bufferText(e.window.buffer); got != tt.want {
+				t.Errorf("typing %s on %q gave %q, want %q", tt.keys, tt.text, got, tt.want)
+			}
+			r, err := e.registers.Get('.')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Text != tt.dot {
+				t.Errorf("typing %s set the . register to %q, want %q", tt.keys, r.Text, tt.dot)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package editor
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// EventFileChangedShell fires when a file open in a buffer was changed on
+	// disk. Handlers receive the path and may return "reload" to load the new
+	// contents, "ask" to let the editor decide, or nothing to keep the buffer.
+	EventFileChangedShell = "FileChangedShell"
+)
+
+// addEventHandler registers a Lua function to be called when the named event fires
+func (e *Editor) addEventHandler(event string, fn *lua.LFunction) {
+	if e.eventHandlers == nil {
+		e.eventHandlers = map[string][]*lua.LFunction{}
+	}
+	e.eventHandlers[event] = append(e.eventHandlers[event], fn)
+}
+
+// fireEvent calls the handlers for the named event with args. It returns the
+// value returned by the last handler and whether there were any handlers.
+func (e *Editor) fireEvent(event string, args ...lua.LValue) (lua.LValue, bool) {
+	handlers := e.eventHandlers[event]
+	result := lua.LValue(lua.LNil)
+	for _, fn := range handlers {
+		err := e.luaState.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...)
+		if err != nil {
+			e.Logger.Error("event handler error", "event", event, "err", err)
+			continue
+		}
+		result = e.luaState.Get(-1)
+		e.luaState.Pop(1)
+	}
+	return result, len(handlers) > 0
+}
@@ -0,0 +1,177 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/excmd"
+	"github.com/jstotz/jim/internal/jim/keys"
+	"github.com/jstotz/jim/internal/jim/modes"
+)
+
+// exBuffer is the buffer of the main window, which the addresses in ex
+// commands refer to
+type exBuffer struct {
+	e *Editor
+}
+
+func (b exBuffer) CurrentLine() int {
+	return b.e.window.CurrentPosition().row
+}
+
+func (b exBuffer) LineCount() int {
+	return b.e.window.buffer.LineCount()
+}
+
+func (b exBuffer) Mark(name rune) (int, bool) {
+	buf := b.e.window.buffer
+	offset, ok := buf.Marks().Get(name)
+	if !ok {
+		return 0, false
+	}
+	return buf.PointAt(offset).row, true
+}
+
+// Search finds the line an address such as /pattern/ refers to. The pattern
+// becomes the last search pattern.
+func (b exBuffer) Search(pattern string, line int, backward bool) (int, error) {
+	e := b.e
+	if pattern == "" {
+		pattern = e.search.pattern
+	}
+	if pattern == "" {
+		return 0, fmt.Errorf("E35: No previous regular expression")
+	}
+	re, err := e.compilePattern(pattern)
+	if err != nil {
+		return 0, err
+	}
+	e.search.pattern, e.search.highlight = pattern, true
+	e.registers.SetReadOnly('/', pattern)
+	e.updateHighlight()
+
+	buf := e.window.buffer
+	lineCount := buf.LineCount()
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := 1; i <= lineCount; i++ {
+		row := ((line-1+i*step)%lineCount+lineCount)%lineCount + 1
+		if text, _ := bufferLine(buf, row); re.MatchString(text) {
+			return row, nil
+		}
+	}
+	return 0, fmt.Errorf("E486: Pattern not found: %s", pattern)
+}
+
+// evalEx parses and runs a line of ex commands. Errors point at the column
+// of the command line they were typed at.
+func (e *Editor) evalEx(ex command.Ex) error {
+	cmd, err := excmd.Parse(ex.Line, exBuffer{e})
+	if err != nil {
+		var exErr *excmd.Error
+		if errors.As(err, &exErr) {
+			exErr.Column += ex.Column - 1
+		}
+		return err
+	}
+	return e.runCommand(cmd)
+}
+
+// deleteLines deletes the lines from first to last into the named register
+func (e *Editor) deleteLines(cmd command.DeleteLines) error {
+	e.registerName = cmd.Register
+	r := region{start: Point{row: cmd.FirstLine, column: 1}, end: Point{row: cmd.LastLine, column: 1}, linewise: true}
+	return e.operate(e.window, command.OperatorDelete, r)
+}
+
+// copyLines copies or moves lines below another line as a single undo step,
+// leaving the cursor on the last line copied
+func (e *Editor) copyLines(cmd command.CopyLines) error {
+	w := e.window
+	b := w.buffer
+	n := cmd.LastLine - cmd.FirstLine + 1
+	if cmd.Move && cmd.Address >= cmd.FirstLine && cmd.Address < cmd.LastLine {
+		return fmt.Errorf("E134: Cannot move a range of lines into itself")
+	}
+	text := b.Slice(b.Offset(Point{row: cmd.FirstLine, column: 1}), b.Offset(Point{row: cmd.LastLine + 1, column: 1}))
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	history := b.UndoTree()
+	history.BeginGroup()
+	defer history.EndGroup()
+	w.SetPosition(Point{row: max(cmd.Address, 1), column: 1})
+	if err := putLines(w, text, cmd.Address == 0); err != nil {
+		return err
+	}
+	last := cmd.Address + n
+	if cmd.Move {
+		first := cmd.FirstLine
+		if cmd.Address < cmd.FirstLine {
+			first += n
+		} else {
+			last = cmd.Address
+		}
+		if err := deleteLineRange(w, first, first+n-1); err != nil {
+			return err
+		}
+	}
+	line, _ := bufferLine(b, last)
+	w.SetPosition(Point{row: last, column: firstNonBlank(line)})
+	return nil
+}
+
+// deleteLineRange deletes the lines from first to last without saving them
+// in a register
+func deleteLineRange(w *Window, first, last int) error {
+	b := w.buffer
+	start, end := b.Offset(Point{row: first, column: 1}), b.Offset(Point{row: last + 1, column: 1})
+	if isLastLine(b, last) && start > 0 {
+		// Deleting the last lines also deletes the newline before them
+		start--
+	}
+	return w.DeleteText(b.PointAt(start), end-start)
+}
+
+// normal types the keys of :normal, on each line of its range if it has one
+func (e *Editor) normal(cmd command.Normal) error {
+	ks := keys.Parse(cmd.Keys)
+	if len(ks) == 0 {
+		return nil
+	}
+	if cmd.FirstLine == 0 {
+		return e.typeNormal(ks)
+	}
+	for row := cmd.FirstLine; row <= min(cmd.LastLine, e.window.buffer.LineCount()); row++ {
+		e.window.SetPosition(Point{row: row, column: 1})
+		if err := e.typeNormal(ks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeNormal types keys in normal mode, then ends whatever they left
+// unfinished as if Esc was typed. Changes made by the keys can be repeated
+// with . as if they had been typed.
+func (e *Editor) typeNormal(ks []keys.Key) error {
+	if e.macro.depth >= maxMacroDepth {
+		return errMacroTooDeep
+	}
+	e.macro.depth++
+	changeDepth := e.changes.depth
+	e.changes.depth = 0
+	err := e.typeKeys(ks, 1)
+	if err == nil && e.mode != modes.ModeNormal {
+		err = e.runCommand(command.ActivateMode{Mode: modes.ModeNormal})
+	}
+	e.changes.depth = changeDepth
+	e.macro.depth--
+	e.inputHandler.Reset()
+	return err
+}
@@ -0,0 +1,310 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/charset"
+	"github.com/jstotz/jim/internal/jim/command"
+)
+
+// modified reports whether a buffer has changes that haven't been saved.
+// Buffers without a file are never modified.
+func modified(b Buffer) bool {
+	fb, ok := b.(*FileBuffer)
+	return ok && fb.Modified()
+}
+
+// sameFile reports whether two paths name the same file
+func sameFile(a, b string) bool {
+	if infoA, err := os.Stat(a); err == nil {
+		if infoB, err := os.Stat(b); err == nil {
+			return os.SameFile(infoA, infoB)
+		}
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// saveBuffer saves the main window's buffer to its file, asking first if the
+// file was changed on disk. If quit is set the editor exits once it's saved.
+func (e *Editor) saveBuffer(quit bool) error {
+	b := e.window.buffer
+	written, err := b.Save()
+	if fb, ok := b.(*FileBuffer); ok && errors.Is(err, ErrChangedOnDisk) {
+		e.showPrompt("WARNING: The file has been changed since reading it! Write anyway? [Y]es, [N]o", map[rune]func() error{
+			'y': func() error {
+				written, err := fb.Overwrite()
+				if err != nil {
+					return err
+				}
+				return e.saved(fb, written, quit)
+			},
+			'n': func() error { return nil },
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return e.saved(b, written, quit)
+}
+
+// saved reports that a buffer was saved, then exits if quit is set
+func (e *Editor) saved(b Buffer, written int, quit bool) error {
+	e.Logger.Debug("Saved buffer", "written", written)
+	if fb, ok := b.(*FileBuffer); ok {
+		e.message = writtenMessage(fb.path, b.LineCount(), written, false)
+	}
+	if quit {
+		return e.quit(command.Quit{})
+	}
+	return nil
+}
+
+func writtenMessage(path string, lines, written int, appended bool) string {
+	verb := "written"
+	if appended {
+		verb = "appended"
+	}
+	return fmt.Sprintf("%q %dL, %dB %s", path, lines, written, verb)
+}
+
+// write writes lines of the main window's buffer to a file. Only writing
+// the whole buffer to its own file saves it; the buffer is still modified
+// after writing it anywhere else.
+func (e *Editor) write(cmd command.Write) error {
+	b := e.window.buffer
+	if cmd.Modified && !modified(b) {
+		if cmd.Quit {
+			return e.quit(command.Quit{Force: cmd.Force})
+		}
+		return nil
+	}
+	first, last := cmd.FirstLine, cmd.LastLine
+	if first == 0 {
+		first, last = 1, b.LineCount()
+	}
+	whole := first == 1 && last == b.LineCount()
+	fb, isFile := b.(*FileBuffer)
+	own := isFile && (cmd.Path == "" || sameFile(cmd.Path, fb.path))
+	path := cmd.Path
+	switch {
+	case path == "" && !isFile:
+		return fmt.Errorf("E32: No file name")
+	case own && fb.readOnly && !cmd.Force:
+		return fmt.Errorf("E45: 'readonly' option is set (add ! to override)")
+	case own && whole && !cmd.Append:
+		if !cmd.Force {
+			return e.saveBuffer(cmd.Quit)
+		}
+		if fb.readOnly {
+			fb.SetReadOnly(false)
+		}
+		written, err := fb.Overwrite()
+		if err != nil {
+			return err
+		}
+		return e.saved(fb, written, cmd.Quit)
+	case own && !cmd.Append && !cmd.Force:
+		return fmt.Errorf("E140: Use ! to write partial buffer")
+	case own:
+		path = fb.path
+	case !cmd.Append && !cmd.Force && statDisk(path).exists:
+		return fmt.Errorf("E13: File exists (add ! to override)")
+	}
+
+	written, err := writeLines(b, first, last, path, cmd.Append)
+	if err != nil {
+		return err
+	}
+	e.message = writtenMessage(path, last-first+1, written, cmd.Append)
+	if cmd.Quit {
+		return e.quit(command.Quit{Force: cmd.Force})
+	}
+	return nil
+}
+
+// writeLines writes the lines from first to last of a buffer to the file at
+// path, with the buffer's line endings and encoding, and returns the number
+// of bytes written. If appending is set they're added to the end of the file.
+func writeLines(b Buffer, first, last int, path string, appending bool) (int, error) {
+	opts := b.Options()
+	text := b.Slice(b.Offset(Point{row: first, column: 1}), b.Offset(Point{row: last + 1, column: 1}))
+	if last == b.LineCount() && opts.EndOfLine {
+		text += "\n"
+	}
+	if ending := opts.FileFormat.lineEnding(); ending != "\n" {
+		text = strings.ReplaceAll(text, "\n", ending)
+	}
+	content, err := charset.Encode([]byte(text), opts.FileEncoding, opts.BOM && !appending)
+	if err != nil {
+		return 0, fmt.Errorf("write %s: %w", path, err)
+	}
+
+	if !appending {
+		write := func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		}
+		if err := writeFileAtomic(path, write, false); err != nil {
+			return 0, fmt.Errorf("write %s: %w", path, err)
+		}
+		return len(content), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return 0, fmt.Errorf("append to %s: %w", path, err)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("append to %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("append to %s: %w", path, err)
+	}
+	return len(content), nil
+}
+
+// writeAll saves every modified buffer, then exits if quit is set
+func (e *Editor) writeAll(cmd command.WriteAll) error {
+	for _, lb := range e.buffers.buffers {
+		if !modified(lb.buffer) {
+			continue
+		}
+		written, err := lb.buffer.Save()
+		if err != nil {
+			return err
+		}
+		if err := e.saved(lb.buffer, written, false); err != nil {
+			return err
+		}
+	}
+	if cmd.Quit {
+		return e.quit(command.Quit{All: true})
+	}
+	return nil
+}
+
+// saveAs writes the main window's buffer to another file, which it's saved
+// to from then on
+func (e *Editor) saveAs(cmd command.SaveAs) error {
+	fb, ok := e.window.buffer.(*FileBuffer)
+	if !ok {
+		return e.write(command.Write{Path: cmd.Path, Force: cmd.Force})
+	}
+	if sameFile(cmd.Path, fb.path) {
+		return e.write(command.Write{Force: cmd.Force})
+	}
+	if !cmd.Force && statDisk(cmd.Path).exists {
+		return fmt.Errorf("E13: File exists (add ! to override)")
+	}
+	old := fb.path
+	if err := fb.SetPath(cmd.Path); err != nil {
+		return err
+	}
+	written, err := fb.Overwrite()
+	if err != nil {
+		return errors.Join(err, fb.SetPath(old))
+	}
+	if e.watcher != nil {
+		e.watcher.Remove(old)
+	}
+	e.registers.SetReadOnly('%', fb.path)
+	e.watchFile(fb.path)
+	return e.saved(fb, written, false)
+}
+
+// edit opens a file in the main window, or reloads the buffer's own file if
+// no other file is given. The buffer it replaces is hidden with its unsaved
+// changes, which ! throws away instead. Reloading a modified buffer requires
+// !.
+func (e *Editor) edit(cmd command.Edit) error {
+	w := e.window
+	b := w.buffer
+	fb, isFile := b.(*FileBuffer)
+	if cmd.Path == "" || (isFile && sameFile(cmd.Path, fb.path)) {
+		if !cmd.Force && modified(b) {
+			return fmt.Errorf("E37: No write since last change (add ! to override)")
+		}
+		if !isFile {
+			return fmt.Errorf("E32: No file name")
+		}
+		if err := fb.Reload(); err != nil {
+			return err
+		}
+		row := min(w.CurrentPosition().row, b.LineCount())
+		line, _ := bufferLine(b, row)
+		w.SetPosition(Point{row: row, column: firstNonBlank(line)})
+		e.message = fmt.Sprintf("%q %dL", fb.path, b.LineCount())
+		return nil
+	}
+
+	if cmd.Force && modified(b) {
+		if err := fb.Reload(); err != nil {
+			return err
+		}
+	}
+	if err := e.LoadFile(cmd.Path); err != nil {
+		return err
+	}
+	e.message = fmt.Sprintf("%q %dL", cmd.Path, e.window.buffer.LineCount())
+	return nil
+}
+
+// read puts the lines of a file below a line of the main window's buffer,
+// leaving the cursor on the first of them
+func (e *Editor) read(cmd command.Read) error {
+	path := cmd.Path
+	if path == "" {
+		fb, ok := e.window.buffer.(*FileBuffer)
+		if !ok {
+			return fmt.Errorf("E32: No file name")
+		}
+		path = fb.path
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("E484: Can't open file %s", path)
+	}
+	enc, bom := charset.Detect(content)
+	text := strings.ReplaceAll(string(charset.Decode(content, enc, bom)), "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	w := e.window
+	w.SetPosition(Point{row: max(cmd.Line, 1), column: 1})
+	return putLines(w, text, cmd.Line == 0)
+}
+
+// quit closes the main window, or exits the editor if it's the last one and
+// no buffer has unsaved changes that would be lost
+func (e *Editor) quit(cmd command.Quit) error {
+	if !cmd.All && e.windowLayout().statusLines() {
+		// Closing a window hides its buffer
+		e.closeWindow(e.window)
+		return nil
+	}
+	if !cmd.Force {
+		b := e.window.buffer
+		switch {
+		case modified(b) && !cmd.All:
+			return fmt.Errorf("E37: No write since last change (add ! to override)")
+		case modified(b):
+			return fmt.Errorf("E162: No write since last change for buffer %q", b.(*FileBuffer).path)
+		}
+		if lb := e.modifiedBuffer(); lb != nil {
+			return fmt.Errorf("E162: No write since last change for buffer %q", lb.name())
+		}
+	}
+	e.exit(nil)
+	return nil
+}
@@ -0,0 +1,79 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/command"
+)
+
+// global runs an ex command on every line that matches a pattern, or that
+// doesn't for :v, as a single undo step. The lines are marked before the
+// command runs on any of them, so the command runs on the lines that matched
+// even as it adds and deletes lines, and lines it deletes are skipped.
+// Without a command the lines are shown.
+func (e *Editor) global(cmd command.Global) error {
+	if e.inGlobal {
+		return fmt.Errorf("E147: Cannot do :global recursive")
+	}
+	pattern := cmd.Pattern
+	if pattern == "" {
+		pattern = e.search.pattern
+	}
+	if pattern == "" {
+		return fmt.Errorf("E35: No previous regular expression")
+	}
+	re, err := e.compilePattern(pattern)
+	if err != nil {
+		return err
+	}
+	e.search.pattern, e.search.highlight = pattern, true
+	e.registers.SetReadOnly('/', pattern)
+	e.updateHighlight()
+
+	w := e.window
+	b := w.buffer
+	var lines []string
+	var marked []*Mark
+	for row := cmd.FirstLine; row <= cmd.LastLine; row++ {
+		line, _ := bufferLine(b, row)
+		if re.MatchString(line) != cmd.Invert {
+			lines = append(lines, line)
+			marked = append(marked, b.Marks().Add(b.Offset(Point{row: row, column: 1})))
+		}
+	}
+	defer func() {
+		for _, m := range marked {
+			b.Marks().Remove(m)
+		}
+	}()
+	if len(marked) == 0 {
+		if cmd.Invert {
+			e.message = "Pattern found in every line: " + pattern
+		} else {
+			e.message = "E486: Pattern not found: " + pattern
+		}
+		return nil
+	}
+	if strings.TrimSpace(cmd.Command) == "" {
+		e.message = strings.Join(lines, "\n")
+		return nil
+	}
+
+	e.inGlobal = true
+	defer func() { e.inGlobal = false }()
+	history := b.UndoTree()
+	history.BeginGroup()
+	defer history.EndGroup()
+	for _, m := range marked {
+		offset, ok := m.Offset()
+		if !ok {
+			continue
+		}
+		w.SetPosition(Point{row: b.PointAt(offset).row, column: 1})
+		if err := e.evalCommand(cmd.Command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
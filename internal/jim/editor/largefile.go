@@ -0,0 +1,230 @@
+package editor
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	// filePageSize is the size of the pages a file source reads and caches
+	filePageSize = 64 * 1024
+	// filePageCacheSize is the number of pages a file source keeps in memory
+	filePageCacheSize = 256
+	// fileIndexInterval is the number of newlines between the offsets kept in
+	// a file source's sparse line index
+	fileIndexInterval = 1024
+)
+
+// fileSource is a piece source that pages content in from a file on demand
+// instead of reading it into memory. Newlines are indexed lazily as far as
+// they have been needed, and only every fileIndexInterval-th one is kept so
+// the index stays small for files with huge numbers of lines.
+type fileSource struct {
+	file *os.File
+	size int
+
+	// indexedTo is how far into the file newlines have been indexed
+	indexedTo int
+	// newlines is the number of newlines before indexedTo
+	newlines int
+	// marks[k] is the offset just past the (k*fileIndexInterval)th newline
+	marks []int
+
+	pages     map[int]*list.Element
+	pageOrder *list.List
+}
+
+type filePage struct {
+	number int
+	data   []byte
+}
+
+// openFileSource opens the file at path as a lazily loaded piece source
+func openFileSource(path string) (*fileSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileSource{
+		file:      f,
+		size:      int(info.Size()),
+		marks:     []int{0},
+		pages:     map[int]*list.Element{},
+		pageOrder: list.New(),
+	}, nil
+}
+
+func (s *fileSource) Close() error {
+	return s.file.Close()
+}
+
+// page returns the given page of the file, reading it if it isn't cached and
+// evicting the least recently used page if the cache is full
+func (s *fileSource) page(number int) []byte {
+	if el, ok := s.pages[number]; ok {
+		s.pageOrder.MoveToFront(el)
+		return el.Value.(*filePage).data
+	}
+	data := make([]byte, filePageSize)
+	n, err := s.file.ReadAt(data, int64(number*filePageSize))
+	if err != nil && err != io.EOF {
+		// The file is expected to stay readable while it's open. Treat an
+		// unreadable page as empty rather than failing every render.
+		n = 0
+	}
+	data = data[:n]
+	if pageEnd := number*filePageSize + n; n < filePageSize && pageEnd < s.size {
+		// The file shrank underneath us. Re-check its size so indexing and
+		// reads stop at the new end instead of expecting the missing pages.
+		s.size = pageEnd
+		if info, err := s.file.Stat(); err == nil {
+			s.size = min(s.size, int(info.Size()))
+		}
+	}
+
+	if s.pageOrder.Len() >= filePageCacheSize {
+		oldest := s.pageOrder.Back()
+		s.pageOrder.Remove(oldest)
+		delete(s.pages, oldest.Value.(*filePage).number)
+	}
+	s.pages[number] = s.pageOrder.PushFront(&filePage{number: number, data: data})
+	return data
+}
+
+func (s *fileSource) chunk(start, end int) []byte {
+	number := start / filePageSize
+	data := s.page(number)
+	pageStart := number * filePageSize
+	if start-pageStart >= len(data) {
+		return nil
+	}
+	return data[start-pageStart : min(end-pageStart, len(data))]
+}
+
+// index scans the file for newlines up to the given offset
+func (s *fileSource) index(to int) {
+	to = min(to, s.size)
+	buf := make([]byte, 1024*1024)
+	for s.indexedTo < to {
+		n, err := s.file.ReadAt(buf[:min(len(buf), s.size-s.indexedTo)], int64(s.indexedTo))
+		if n == 0 && err != nil {
+			// Stop indexing a file that was truncated underneath us
+			s.size = s.indexedTo
+			return
+		}
+		data := buf[:n]
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			s.newlines++
+			if s.newlines%fileIndexInterval == 0 {
+				s.marks = append(s.marks, s.indexedTo+(n-len(data))+i+1)
+			}
+			data = data[i+1:]
+		}
+		s.indexedTo += n
+	}
+}
+
+func (s *fileSource) indexed(end int) bool {
+	return end <= s.indexedTo
+}
+
+// rank returns the number of newlines before offset
+func (s *fileSource) rank(offset int) int {
+	s.index(offset)
+	k := sort.SearchInts(s.marks, offset+1) - 1
+	return k*fileIndexInterval + s.countBytes(s.marks[k], offset)
+}
+
+// countBytes counts the newlines between start and end by reading the pages
+func (s *fileSource) countBytes(start, end int) int {
+	count := 0
+	for start < end {
+		data := s.chunk(start, end)
+		if len(data) == 0 {
+			break
+		}
+		count += bytes.Count(data, []byte{'\n'})
+		start += len(data)
+	}
+	return count
+}
+
+func (s *fileSource) countNewlines(start, end int) int {
+	if start >= end {
+		return 0
+	}
+	return s.rank(end) - s.rank(start)
+}
+
+func (s *fileSource) nthNewline(start, n, limit int) int {
+	target := s.rank(start) + n
+	// Index until the target newline has been seen or the limit is reached
+	for s.newlines < target && s.indexedTo < min(limit, s.size) {
+		s.index(s.indexedTo + filePageSize)
+	}
+	if s.newlines < target {
+		return -1
+	}
+
+	// Scan forward from the closest mark before the target newline
+	k := (target - 1) / fileIndexInterval
+	offset := s.marks[k]
+	remaining := target - k*fileIndexInterval
+	for offset < s.size {
+		data := s.chunk(offset, s.size)
+		if len(data) == 0 {
+			break
+		}
+		if c := bytes.Count(data, []byte{'\n'}); c < remaining {
+			remaining -= c
+			offset += len(data)
+			continue
+		}
+		for i, b := range data {
+			if b != '\n' {
+				continue
+			}
+			if remaining--; remaining == 0 {
+				if offset+i >= limit {
+					return -1
+				}
+				return offset + i
+			}
+		}
+	}
+	return -1
+}
+
+// loadLargeFile replaces the text of mb with the contents of the file at
+// path, paged in from disk on demand. The file must not be modified in place
+// while the returned source is open.
+func loadLargeFile(path string, mb *MemoryBuffer) (*fileSource, error) {
+	src, err := openFileSource(path)
+	if err != nil {
+		return nil, fmt.Errorf("open large file: %w", err)
+	}
+	length := src.size
+	// Lines are stored without the final line ending, as in ReadFrom
+	mb.options.EndOfLine = length == 0
+	if length > 0 {
+		if last := src.chunk(length-1, length); len(last) == 1 && last[0] == '\n' {
+			mb.options.EndOfLine = true
+			length--
+		}
+	}
+	mb.text = newPieceTableFromSource(src, length)
+	return src, nil
+}
@@ -0,0 +1,47 @@
+package editor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLargeFileTruncated checks that reading a large file buffer whose file
+// was truncated underneath it stops at the new end of the file
+func TestLargeFileTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large.txt")
+	text := largeText(50_000)
+	if err := os.WriteFile(path, text, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mb := NewMemoryBuffer(nil)
+	src, err := loadLargeFile(path, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err := os.Truncate(path, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if got := mb.Slice(0, mb.text.Len()); got != string(text[:1000]) {
+			t.Errorf("Slice() returned %d bytes, want the 1000 left in the file", len(got))
+		}
+		if lines := mb.LinesInRange(LineRange{1, 100_000}); len(lines) == 0 || len(lines) > 100_000 {
+			t.Errorf("LinesInRange() returned %d lines", len(lines))
+		}
+		if _, err := mb.text.WriteTo(io.Discard); err == nil {
+			t.Error("WriteTo() succeeded, want an error for the missing text")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("reading the truncated file didn't finish")
+	}
+}
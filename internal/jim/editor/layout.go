@@ -0,0 +1,619 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jstotz/jim/internal/jim/command"
+)
+
+const (
+	statusLineStart         = "\033[1;7m"
+	statusLineInactiveStart = "\033[7m"
+	styleReset              = "\033[0m"
+	windowSeparator         = "|"
+)
+
+var errNotEnoughRoom = errors.New("E36: Not enough room")
+
+// layoutNode is a node in the tree of windows on the screen: a window, or a
+// split of its space into nodes stacked one above the other, or side by side
+// if vertical is set
+type layoutNode struct {
+	parent   *layoutNode
+	window   *Window
+	vertical bool
+	children []*layoutNode
+	// size is the number of rows the node takes up in a split stacking it,
+	// or of columns in a vertical split, status line included
+	size int
+}
+
+// windowLayout arranges the windows on the screen above the command line.
+// With more than one window each has a status line below it, and windows
+// side by side are separated by a column of |.
+type windowLayout struct {
+	root   *layoutNode
+	width  int
+	height int
+}
+
+func newWindowLayout(w *Window, width, height int) *windowLayout {
+	return &windowLayout{root: &layoutNode{window: w}, width: width, height: height}
+}
+
+// windowLayout returns the layout of the windows, laying out the main window
+// on its own if there isn't one yet
+func (e *Editor) windowLayout() *windowLayout {
+	if e.layout == nil {
+		e.layout = newWindowLayout(e.window, e.window.width, e.window.height)
+	}
+	return e.layout
+}
+
+// windows returns the windows in the layout from the top left to the bottom
+// right
+func (l *windowLayout) windows() []*Window {
+	return l.root.appendWindows(nil)
+}
+
+func (n *layoutNode) appendWindows(ws []*Window) []*Window {
+	if n.window != nil {
+		return append(ws, n.window)
+	}
+	for _, c := range n.children {
+		ws = c.appendWindows(ws)
+	}
+	return ws
+}
+
+// find returns the node of a window, or nil if it isn't in the layout
+func (l *windowLayout) find(w *Window) *layoutNode {
+	return l.root.find(w)
+}
+
+func (n *layoutNode) find(w *Window) *layoutNode {
+	if n.window != nil {
+		if n.window == w {
+			return n
+		}
+		return nil
+	}
+	for _, c := range n.children {
+		if found := c.find(w); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// statusLines reports whether the windows have status lines, which they do
+// when there is more than one
+func (l *windowLayout) statusLines() bool {
+	return l.root.window == nil
+}
+
+// minSize returns the fewest rows a node can take up, or columns if vertical
+// is set
+func (n *layoutNode) minSize(vertical bool) int {
+	if n.window != nil {
+		if vertical {
+			return 1
+		}
+		// A line of text and the status line
+		return 2
+	}
+	size := 0
+	for _, c := range n.children {
+		if n.vertical == vertical {
+			size += c.minSize(vertical)
+		} else {
+			size = max(size, c.minSize(vertical))
+		}
+	}
+	if vertical && n.vertical {
+		size += len(n.children) - 1
+	}
+	return size
+}
+
+// replace puts another node in the place of n in the tree
+func (l *windowLayout) replace(n, other *layoutNode) {
+	other.parent = n.parent
+	if n.parent == nil {
+		l.root = other
+		return
+	}
+	i := slices.Index(n.parent.children, n)
+	n.parent.children[i] = other
+}
+
+// arrange places every window on the screen and sizes it to fit its node
+func (l *windowLayout) arrange() {
+	l.root.arrange(0, 0, l.width, l.height, l.statusLines())
+}
+
+func (n *layoutNode) arrange(row, column, width, height int, statusLine bool) {
+	if n.window != nil {
+		if statusLine {
+			height--
+		}
+		n.window.resize(row, column, width, height)
+		return
+	}
+	if n.vertical {
+		n.fitChildren(width - (len(n.children) - 1))
+	} else {
+		n.fitChildren(height)
+	}
+	for _, c := range n.children {
+		if n.vertical {
+			c.arrange(row, column, c.size, height, statusLine)
+			column += c.size + len(windowSeparator)
+		} else {
+			c.arrange(row, column, width, c.size, statusLine)
+			row += c.size
+		}
+	}
+}
+
+// fitChildren makes the sizes of a split's children add up to space, growing
+// or shrinking the last ones
+func (n *layoutNode) fitChildren(space int) {
+	diff := space
+	for _, c := range n.children {
+		diff -= c.size
+	}
+	for i := len(n.children) - 1; i >= 0 && diff != 0; i-- {
+		c := n.children[i]
+		size := max(c.size+diff, c.minSize(n.vertical))
+		diff -= size - c.size
+		c.size = size
+	}
+}
+
+// split makes room for a new window over the same buffer as w above it, or
+// to its left if vertical is set, by halving the space w takes up
+func (l *windowLayout) split(w *Window, vertical bool) (*Window, error) {
+	leaf := l.find(w)
+	if leaf == nil {
+		return nil, fmt.Errorf("window not in layout")
+	}
+	// The space the window takes up before the split, and what each of the
+	// two takes up after it
+	var space, newSize int
+	if vertical {
+		space = w.width
+		if space < 2*leaf.minSize(true)+len(windowSeparator) {
+			return nil, errNotEnoughRoom
+		}
+		newSize = (space - len(windowSeparator)) / 2
+	} else {
+		space = w.height
+		if l.statusLines() {
+			space++
+		}
+		if space < 2*leaf.minSize(false) {
+			return nil, errNotEnoughRoom
+		}
+		newSize = space / 2
+	}
+
+	nw := NewWindow(w.buffer, 0, 0, w.width, w.height, w.logger)
+	nw.visibleLines, nw.cursor, nw.highlight = w.visibleLines, w.cursor, w.highlight
+	newLeaf := &layoutNode{window: nw, size: newSize}
+	parent := leaf.parent
+	if parent == nil || parent.vertical != vertical {
+		split := &layoutNode{vertical: vertical, size: leaf.size}
+		l.replace(leaf, split)
+		parent = split
+		parent.children = []*layoutNode{leaf}
+		leaf.parent = split
+	}
+	newLeaf.parent = parent
+	i := slices.Index(parent.children, leaf)
+	parent.children = slices.Insert(parent.children, i, newLeaf)
+	leaf.size = space - newSize
+	if vertical {
+		leaf.size -= len(windowSeparator)
+	}
+	l.arrange()
+	return nw, nil
+}
+
+// close removes a window from the layout, giving its space to the window
+// above or to the left of it, or the one after it if it's the first, and
+// returns that window. The last window can't be closed.
+func (l *windowLayout) close(w *Window) *Window {
+	leaf := l.find(w)
+	if leaf == nil || leaf.parent == nil {
+		return nil
+	}
+	parent := leaf.parent
+	i := slices.Index(parent.children, leaf)
+	parent.children = slices.Delete(parent.children, i, i+1)
+	neighbor := parent.children[max(i-1, 0)]
+	windows := neighbor.appendWindows(nil)
+	next := windows[0]
+	if i > 0 {
+		next = windows[len(windows)-1]
+	}
+	neighbor.size += leaf.size
+	if parent.vertical {
+		neighbor.size += len(windowSeparator)
+	}
+
+	if len(parent.children) == 1 {
+		// A split of one is just its child
+		child := parent.children[0]
+		child.size = parent.size
+		l.replace(parent, child)
+		if gp := child.parent; gp != nil && child.window == nil && gp.vertical == child.vertical {
+			// Merge a split into a split in the same direction
+			j := slices.Index(gp.children, child)
+			for _, c := range child.children {
+				c.parent = gp
+			}
+			gp.children = slices.Replace(gp.children, j, j+1, child.children...)
+		}
+	}
+	l.arrange()
+	return next
+}
+
+// equalize gives every window the same space, as far as the minimum sizes
+// of the windows allow
+func (l *windowLayout) equalize() {
+	l.root.equalize(l.width, l.height)
+	l.arrange()
+}
+
+func (n *layoutNode) equalize(width, height int) {
+	if n.window != nil {
+		return
+	}
+	space := height
+	if n.vertical {
+		space = width - (len(n.children) - 1)
+	}
+	// Splits get space for each of the windows they put in a row
+	total := n.count(n.vertical)
+	given := 0
+	for _, c := range n.children {
+		c.size = space * c.count(n.vertical) / total
+		given += c.size
+	}
+	for i := 0; given < space; i++ {
+		n.children[i%len(n.children)].size++
+		given++
+	}
+	n.growToMinimum()
+	for _, c := range n.children {
+		if n.vertical {
+			c.equalize(c.size, height)
+		} else {
+			c.equalize(width, c.size)
+		}
+	}
+}
+
+// count returns the number of windows a node puts one above the other, or
+// side by side if vertical is set
+func (n *layoutNode) count(vertical bool) int {
+	if n.window != nil {
+		return 1
+	}
+	count := 0
+	for _, c := range n.children {
+		if n.vertical == vertical {
+			count += c.count(vertical)
+		} else {
+			count = max(count, c.count(vertical))
+		}
+	}
+	return count
+}
+
+// growToMinimum grows the children of a split that are smaller than they can
+// be, taking the space from the others
+func (n *layoutNode) growToMinimum() {
+	for _, c := range n.children {
+		need := c.minSize(n.vertical) - c.size
+		for _, other := range n.children {
+			if need <= 0 {
+				break
+			}
+			take := min(need, other.size-other.minSize(n.vertical))
+			if other == c || take <= 0 {
+				continue
+			}
+			other.size -= take
+			c.size += take
+			need -= take
+		}
+	}
+}
+
+// resize changes the height of a window, or its width if vertical is set,
+// taking the space from the windows after it and then the ones before it, or
+// giving it to the window after it. With absolute set the size becomes delta,
+// or as large as possible if delta is 0.
+func (l *windowLayout) resize(w *Window, vertical bool, delta int, absolute bool) {
+	// Resize the window, or the split it's in that is part of a split in the
+	// right direction
+	n := l.find(w)
+	for n != nil && n.parent != nil && n.parent.vertical != vertical {
+		n = n.parent
+	}
+	if n == nil || n.parent == nil {
+		return
+	}
+	current := w.height
+	if vertical {
+		current = w.width
+	}
+	// The space around the window in the node, such as its status line
+	extra := n.size - current
+	target := n.size + delta
+	switch {
+	case absolute && delta == 0:
+		target = l.width + l.height
+	case absolute:
+		target = delta + extra
+	}
+
+	siblings := n.parent.children
+	i := slices.Index(siblings, n)
+	maxSize := n.size
+	for _, s := range siblings {
+		if s != n {
+			maxSize += s.size - s.minSize(vertical)
+		}
+	}
+	target = min(max(target, n.minSize(vertical)), maxSize)
+	diff := target - n.size
+	n.size = target
+
+	others := slices.Clone(siblings[i+1:])
+	for j := i - 1; j >= 0; j-- {
+		others = append(others, siblings[j])
+	}
+	for _, s := range others {
+		if diff == 0 {
+			break
+		}
+		if diff < 0 {
+			s.size -= diff
+			break
+		}
+		take := min(diff, s.size-s.minSize(vertical))
+		s.size -= take
+		diff -= take
+	}
+	l.arrange()
+}
+
+// neighbor returns the window next to w in a direction: h, j, k or l. When
+// several are, it's the one beside the cursor. It returns nil if there is
+// none.
+func (l *windowLayout) neighbor(w *Window, direction rune) *Window {
+	// The cursor's place on the screen, counted from 0
+	cursorRow := w.rowOffset + w.cursor.row - 1
+	cursorColumn := w.columnOffset + w.cursor.column - 1
+	var best *Window
+	bestDistance := 0
+	for _, c := range l.windows() {
+		var distance, near, far, at int
+		switch direction {
+		case 'h':
+			distance = w.columnOffset - (c.columnOffset + c.width)
+			near, far, at = c.rowOffset, c.rowOffset+c.height, cursorRow
+		case 'l':
+			distance = c.columnOffset - (w.columnOffset + w.width)
+			near, far, at = c.rowOffset, c.rowOffset+c.height, cursorRow
+		case 'k':
+			distance = w.rowOffset - (c.rowOffset + c.height)
+			near, far, at = c.columnOffset, c.columnOffset+c.width, cursorColumn
+		case 'j':
+			distance = c.rowOffset - (w.rowOffset + w.height)
+			near, far, at = c.columnOffset, c.columnOffset+c.width, cursorColumn
+		}
+		if c == w || distance <= 0 || !overlaps(w, c, direction == 'h' || direction == 'l') {
+			continue
+		}
+		beside := at >= near && at < far
+		if best == nil || distance < bestDistance || (distance == bestDistance && beside) {
+			best, bestDistance = c, distance
+		}
+	}
+	return best
+}
+
+// overlaps reports whether two windows share rows if rows is set, or columns
+// otherwise. A window's rows include its status line.
+func overlaps(a, b *Window, rows bool) bool {
+	if rows {
+		return a.rowOffset < b.rowOffset+b.height+1 && b.rowOffset < a.rowOffset+a.height+1
+	}
+	return a.columnOffset < b.columnOffset+b.width && b.columnOffset < a.columnOffset+a.width
+}
+
+// render renders the lines of the screen above the command line. current is
+// the window with the focus, whose status line stands out.
+func (l *windowLayout) render(current *Window, status func(w *Window) string) []string {
+	return l.root.render(current, status, l.statusLines())
+}
+
+func (n *layoutNode) render(current *Window, status func(w *Window) string, statusLine bool) []string {
+	if w := n.window; w != nil {
+		content := w.Render()
+		var lines []string
+		if content != "" {
+			lines = strings.Split(content, "\r\n")
+		}
+		for i := range lines {
+			lines[i] = fitLine(lines[i], w.width)
+		}
+		for len(lines) < w.height {
+			lines = append(lines, strings.Repeat(" ", w.width))
+		}
+		if statusLine {
+			start := statusLineInactiveStart
+			if w == current {
+				start = statusLineStart
+			}
+			lines = append(lines, start+fitLine(status(w), w.width)+styleReset)
+		}
+		return lines
+	}
+
+	var lines []string
+	for i, c := range n.children {
+		childLines := c.render(current, status, statusLine)
+		if !n.vertical {
+			lines = append(lines, childLines...)
+			continue
+		}
+		if i == 0 {
+			lines = childLines
+			continue
+		}
+		for row := range lines {
+			lines[row] += windowSeparator + childLines[row]
+		}
+	}
+	return lines
+}
+
+// fitLine cuts a rendered line to width columns or pads it with spaces to
+// width. Escape sequences don't take up any columns, and styles are reset at
+// the end of a line that has any.
+func fitLine(s string, width int) string {
+	var sb strings.Builder
+	columns := 0
+	styled := false
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			end := i + 1
+			if end < len(s) && s[end] == '[' {
+				end++
+				for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+					end++
+				}
+				end++
+			}
+			end = min(end, len(s))
+			sb.WriteString(s[i:end])
+			styled = true
+			i = end
+			continue
+		}
+		if columns == width {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		sb.WriteString(s[i : i+size])
+		columns++
+		i += size
+	}
+	if styled {
+		sb.WriteString(styleReset)
+	}
+	sb.WriteString(strings.Repeat(" ", width-columns))
+	return sb.String()
+}
+
+// windowStatus is the status line of a window: the name of its buffer and
+// whether it's modified
+func (e *Editor) windowStatus(w *Window) string {
+	name := "[No Name]"
+	if fb, ok := w.buffer.(*FileBuffer); ok {
+		name = fb.path
+	}
+	if modified(w.buffer) {
+		name += " [+]"
+	}
+	return name
+}
+
+// focusWindow makes w the window commands apply to, and its buffer the
+// current buffer
+func (e *Editor) focusWindow(w *Window) {
+	e.window = w
+	if lb := e.buffers.entry(w.buffer); lb != nil {
+		e.buffers.current = lb
+		e.registers.SetReadOnly('%', lb.name())
+	}
+	// Another window may have deleted the lines the cursor was on
+	p := w.CurrentPosition()
+	if lineCount := w.buffer.LineCount(); p.row > lineCount {
+		w.SetPosition(Point{row: max(lineCount, 1), column: 1})
+	}
+}
+
+// splitWindow splits the main window, moving to the new window. It shows
+// the file at the given path if there is one.
+func (e *Editor) splitWindow(cmd command.SplitWindow) error {
+	w, err := e.windowLayout().split(e.window, cmd.Vertical)
+	if err != nil {
+		e.message = err.Error()
+		return nil
+	}
+	e.focusWindow(w)
+	if cmd.Path != "" {
+		return e.LoadFile(cmd.Path)
+	}
+	return nil
+}
+
+// focusNeighbor moves to the window next to the main window in a direction,
+// or to the next window in the layout for w
+func (e *Editor) focusNeighbor(direction rune) {
+	layout := e.windowLayout()
+	if direction == 'w' {
+		windows := layout.windows()
+		i := slices.Index(windows, e.window)
+		e.focusWindow(windows[(i+1)%len(windows)])
+		return
+	}
+	if w := layout.neighbor(e.window, direction); w != nil {
+		e.focusWindow(w)
+	}
+}
+
+// closeWindow closes a window, moving to the window that takes its space if
+// it was the main one. The buffer it showed stays in the buffer list.
+func (e *Editor) closeWindow(w *Window) {
+	layout := e.windowLayout()
+	if !layout.statusLines() {
+		e.message = "E444: Cannot close last window"
+		return
+	}
+	if next := layout.close(w); w == e.window && next != nil {
+		e.focusWindow(next)
+	}
+}
+
+// onlyWindow closes every window but the main one
+func (e *Editor) onlyWindow() {
+	layout := e.windowLayout()
+	for _, w := range layout.windows() {
+		if w != e.window {
+			layout.close(w)
+		}
+	}
+}
+
+// windowsShowing returns the windows showing a buffer
+func (e *Editor) windowsShowing(b Buffer) []*Window {
+	var ws []*Window
+	for _, w := range e.windowLayout().windows() {
+		if w.buffer == b {
+			ws = append(ws, w)
+		}
+	}
+	return ws
+}
@@ -0,0 +1,268 @@
+package editor
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// newTestLayout returns a layout of a single window the size of the screen
+func newTestLayout(width, height int) (*windowLayout, *Window) {
+	w := NewWindow(NewMemoryBuffer(nil), 0, 0, width, height, nil)
+	return newWindowLayout(w, width, height), w
+}
+
+// geometry describes where the windows of a layout are, from the top left
+// to the bottom right, as row,column widthxheight
+func geometry(l *windowLayout) string {
+	var parts []string
+	for _, w := range l.windows() {
+		parts = append(parts, fmt.Sprintf("%d,%d %dx%d", w.rowOffset, w.columnOffset, w.width, w.height))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestLayoutSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		splits []bool
+		want   string
+	}{
+		{"stacked", []bool{false}, "0,0 80x11 12,0 80x11"},
+		{"side by side", []bool{true}, "0,0 39x23 0,40 40x23"},
+		{"stacked twice", []bool{false, false}, "0,0 80x5 6,0 80x5 12,0 80x11"},
+		{"side by side twice", []bool{true, true}, "0,0 19x23 0,20 19x23 0,40 40x23"},
+		{"stacked then side by side", []bool{false, true}, "0,0 39x11 0,40 40x11 12,0 80x11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, w := newTestLayout(80, 24)
+			for _, vertical := range tt.splits {
+				var err error
+				// Split the new window each time, as :split focuses it
+				if w, err = l.split(w, vertical); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := geometry(l); got != tt.want {
+				t.Errorf("windows at %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutSplitNotEnoughRoom(t *testing.T) {
+	l, w := newTestLayout(3, 4)
+	w, err := l.split(w, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.split(w, false); err != errNotEnoughRoom {
+		t.Errorf("splitting a window of 1 line gave %v, want %v", err, errNotEnoughRoom)
+	}
+	if _, err := l.split(w, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.split(w, true); err != errNotEnoughRoom {
+		t.Errorf("splitting a window 1 column wide gave %v, want %v", err, errNotEnoughRoom)
+	}
+}
+
+func TestLayoutClose(t *testing.T) {
+	tests := []struct {
+		name  string
+		close int
+		want  string
+		focus int
+	}{
+		{"first gives its space to the next", 0, "0,0 80x11 12,0 80x11", 0},
+		{"middle gives its space to the one above", 1, "0,0 80x11 12,0 80x11", 0},
+		{"last gives its space to the one above", 2, "0,0 80x5 6,0 80x17", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, w := newTestLayout(80, 24)
+			w, _ = l.split(w, false)
+			l.split(w, false)
+			closed := l.windows()[tt.close]
+			next := l.close(closed)
+			if got := geometry(l); got != tt.want {
+				t.Errorf("windows at %s, want %s", got, tt.want)
+			}
+			if next != l.windows()[tt.focus] {
+				t.Errorf("close returned window %v, want window %d", next, tt.focus)
+			}
+		})
+	}
+}
+
+func TestLayoutCloseCollapsesSplits(t *testing.T) {
+	l, w := newTestLayout(80, 24)
+	left, _ := l.split(w, true)
+	top, _ := l.split(left, false)
+	l.close(w)
+	// The stacked windows are all that's left, so they fill the screen
+	if got, want := geometry(l), "0,0 80x11 12,0 80x11"; got != want {
+		t.Errorf("windows at %s, want %s", got, want)
+	}
+	if l.root.window != nil || l.root.vertical {
+		t.Error("the root should be the stacked split")
+	}
+	l.close(top)
+	if l.root.window != left || l.statusLines() {
+		t.Error("the last window should be the root, without a status line")
+	}
+	if got, want := geometry(l), "0,0 80x24"; got != want {
+		t.Errorf("windows at %s, want %s", got, want)
+	}
+	if l.close(left) != nil {
+		t.Error("closing the last window should fail")
+	}
+}
+
+func TestLayoutResize(t *testing.T) {
+	tests := []struct {
+		name     string
+		vertical bool
+		delta    int
+		absolute bool
+		want     string
+	}{
+		{"grow", false, 3, false, "0,0 80x14 15,0 80x8"},
+		{"shrink", false, -3, false, "0,0 80x8 9,0 80x14"},
+		{"set", false, 5, true, "0,0 80x5 6,0 80x17"},
+		{"largest", false, 0, true, "0,0 80x21 22,0 80x1"},
+		{"smallest", false, -50, false, "0,0 80x1 2,0 80x21"},
+		{"width in a stack", true, 10, false, "0,0 80x11 12,0 80x11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, w := newTestLayout(80, 24)
+			top, _ := l.split(w, false)
+			l.resize(top, tt.vertical, tt.delta, tt.absolute)
+			if got := geometry(l); got != tt.want {
+				t.Errorf("windows at %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The last window can only grow by taking space from the ones before it,
+// nearest first
+func TestLayoutResizeTakesFromEarlierWindows(t *testing.T) {
+	l, w := newTestLayout(80, 24)
+	middle, _ := l.split(w, true)
+	l.split(middle, true)
+	l.resize(w, true, 10, false)
+	if got, want := geometry(l), "0,0 19x23 0,20 9x23 0,30 50x23"; got != want {
+		t.Errorf("windows at %s, want %s", got, want)
+	}
+}
+
+func TestLayoutEqualize(t *testing.T) {
+	l, w := newTestLayout(80, 24)
+	top, _ := l.split(w, false)
+	l.split(top, false)
+	l.split(w, true)
+	l.equalize()
+	// Each of the three rows of windows gets the same height, and the two
+	// windows side by side the same width
+	if got, want := geometry(l), "0,0 80x7 8,0 80x7 16,0 40x7 16,41 39x7"; got != want {
+		t.Errorf("windows at %s, want %s", got, want)
+	}
+}
+
+// TestLayoutTiles splits, closes and resizes windows at random and checks
+// that the windows always cover the screen exactly, separators and status
+// lines included
+func TestLayoutTiles(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 20 {
+		width, height := 10+r.Intn(70), 4+r.Intn(30)
+		l, _ := newTestLayout(width, height)
+		for range 200 {
+			ws := l.windows()
+			w := ws[r.Intn(len(ws))]
+			switch r.Intn(5) {
+			case 0, 1:
+				l.split(w, r.Intn(2) == 0)
+			case 2:
+				l.close(w)
+			case 3:
+				l.resize(w, r.Intn(2) == 0, r.Intn(21)-10, r.Intn(4) == 0)
+			case 4:
+				l.equalize()
+			}
+			checkTiles(t, l)
+		}
+	}
+}
+
+func checkTiles(t *testing.T, l *windowLayout) {
+	t.Helper()
+	screen := make([][]int, l.height)
+	for row := range screen {
+		screen[row] = make([]int, l.width)
+	}
+	status := 0
+	if l.statusLines() {
+		status = 1
+	}
+	for _, w := range l.windows() {
+		if w.width < 1 || w.height < 1 {
+			t.Fatalf("window of %dx%d in %s", w.width, w.height, geometry(l))
+		}
+		for row := w.rowOffset; row < w.rowOffset+w.height+status; row++ {
+			for column := w.columnOffset; column < w.columnOffset+w.width; column++ {
+				if row >= l.height || column >= l.width {
+					t.Fatalf("window off the %dx%d screen in %s", l.width, l.height, geometry(l))
+				}
+				screen[row][column]++
+			}
+		}
+	}
+	// Every cell is covered once, except for the separators between
+	// windows side by side
+	for row := range screen {
+		for column, n := range screen[row] {
+			if n > 1 {
+				t.Fatalf("windows overlap at %d,%d in %s", row, column, geometry(l))
+			}
+			if n == 0 && (column == 0 || column == l.width-1 || screen[row][column-1] == 0 || screen[row][column+1] == 0) {
+				t.Fatalf("nothing at %d,%d in %s", row, column, geometry(l))
+			}
+		}
+	}
+}
+
+func TestWindowCommands(t *testing.T) {
+	e := newTestEditor(t, "text")
+	first := e.window
+	for _, cmd := range []string{"split", "vsplit"} {
+		if err := e.evalCommand(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	if got := len(e.windowLayout().windows()); got != 3 {
+		t.Fatalf("%d windows after :split and :vsplit, want 3", got)
+	}
+	if e.window == first || e.window.buffer != first.buffer {
+		t.Error("the new window should have the focus and show the same buffer")
+	}
+	if err := e.evalCommand("close"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.evalCommand("only"); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(e.windowLayout().windows()); got != 1 {
+		t.Errorf("%d windows after :only, want 1", got)
+	}
+	if err := e.evalCommand("close"); err != nil {
+		t.Fatal(err)
+	}
+	if e.message != "E444: Cannot close last window" {
+		t.Errorf("closing the last window reported %q", e.message)
+	}
+}
@@ -0,0 +1,101 @@
+package editor
+
+import (
+	"errors"
+
+	"github.com/jstotz/jim/internal/jim/keys"
+	"github.com/jstotz/jim/internal/jim/registers"
+)
+
+// maxMacroDepth limits how deeply macros can play other macros, including
+// themselves
+const maxMacroDepth = 100
+
+var errMacroTooDeep = errors.New("E169: Command too recursive")
+
+// macroState tracks the recording and playing of macros. Macros are stored in
+// registers as key notation, e.g. "dw<Esc>", so that they can be edited as
+// text.
+type macroState struct {
+	// recording is the register keys are being recorded into, or 0
+	recording rune
+	keys      []keys.Key
+	// last is the register played last, which @@ plays again
+	last rune
+	// depth is how many macros are playing, one inside another
+	depth int
+}
+
+// recordKey records a key typed by the user while recording a macro
+func (e *Editor) recordKey(k keys.Key) {
+	if e.macro.recording != 0 && e.macro.depth == 0 {
+		e.macro.keys = append(e.macro.keys, k)
+	}
+}
+
+func (e *Editor) startRecording(name rune) {
+	if !registers.Writable(name) || name == '_' {
+		return
+	}
+	e.macro.recording = name
+	e.macro.keys = nil
+}
+
+// stopRecording stores the keys recorded, except for the key that stopped
+// recording
+func (e *Editor) stopRecording() {
+	recorded := e.macro.keys[:max(len(e.macro.keys)-1, 0)]
+	if err := e.registers.Set(e.macro.recording, registers.Register{Text: keys.Format(recorded)}); err != nil {
+		e.message = err.Error()
+	}
+	e.macro.recording = 0
+	e.macro.keys = nil
+}
+
+// playMacro types the keys stored in a register count times. Changes made by
+// the macro can be repeated with . as if they had been typed.
+func (e *Editor) playMacro(name rune, count int) error {
+	if name == '@' {
+		if e.macro.last == 0 {
+			e.message = "E748: No previously used register"
+			return nil
+		}
+		name = e.macro.last
+	}
+	r, err := e.registers.Get(name)
+	if err != nil {
+		e.message = err.Error()
+		return nil
+	}
+	e.macro.last = name
+	if e.macro.depth >= maxMacroDepth {
+		return errMacroTooDeep
+	}
+
+	e.macro.depth++
+	changeDepth := e.changes.depth
+	e.changes.depth = 0
+	err = e.typeKeys(keys.Parse(r.Text), max(count, 1))
+	e.changes.depth = changeDepth
+	e.macro.depth--
+
+	if errors.Is(err, errMacroTooDeep) && e.macro.depth == 0 {
+		// Abandon any keys left pending by the macros stopped part way
+		e.inputHandler.Reset()
+		e.message = err.Error()
+		return nil
+	}
+	return err
+}
+
+// typeKeys handles keys as if they were typed count times
+func (e *Editor) typeKeys(ks []keys.Key, count int) error {
+	for range count {
+		for _, k := range ks {
+			if err := e.handleKeypress(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package editor
+
+import "strings"
+
+// Mark is a position in a buffer that moves with the text around it as the
+// buffer is edited. Deleting the line a mark is on deletes the mark.
+type Mark struct {
+	offset  int
+	deleted bool
+}
+
+// Offset returns the byte offset of the mark, or false if it was deleted
+func (m *Mark) Offset() (int, bool) {
+	return m.offset, !m.deleted
+}
+
+// Marks are the marks set in a buffer: the ones named a to z that the user
+// sets with m, and unnamed ones used to keep track of lines while commands
+// such as :global edit the buffer
+type Marks struct {
+	named map[rune]*Mark
+	all   map[*Mark]struct{}
+}
+
+// Add adds an unnamed mark at offset. It moves with the text until it's
+// removed.
+func (ms *Marks) Add(offset int) *Mark {
+	if ms.all == nil {
+		ms.all = map[*Mark]struct{}{}
+	}
+	m := &Mark{offset: offset}
+	ms.all[m] = struct{}{}
+	return m
+}
+
+// Remove stops a mark from moving with the text
+func (ms *Marks) Remove(m *Mark) {
+	delete(ms.all, m)
+}
+
+// Set sets the named mark to offset
+func (ms *Marks) Set(name rune, offset int) {
+	if m, ok := ms.named[name]; ok {
+		ms.Remove(m)
+	}
+	if ms.named == nil {
+		ms.named = map[rune]*Mark{}
+	}
+	ms.named[name] = ms.Add(offset)
+}
+
+// Get returns the offset of the named mark, or false if it isn't set
+func (ms *Marks) Get(name rune) (int, bool) {
+	m, ok := ms.named[name]
+	if !ok {
+		return 0, false
+	}
+	return m.Offset()
+}
+
+// Clear deletes every mark
+func (ms *Marks) Clear() {
+	for m := range ms.all {
+		m.deleted = true
+	}
+	ms.named = nil
+	ms.all = nil
+}
+
+// inserted moves the marks at or after offset past length inserted bytes
+func (ms *Marks) inserted(offset, length int) {
+	for m := range ms.all {
+		if m.offset >= offset {
+			m.offset += length
+		}
+	}
+}
+
+// deleted moves the marks after the text deleted at offset back over it.
+// Marks in the text are deleted if the rest of their line was deleted with
+// its newline, or if everything up to the end of the buffer was deleted from
+// the line before theirs. Otherwise they move to where the text was.
+func (ms *Marks) deleted(offset int, text string, atEnd bool) {
+	end := offset + len(text)
+	for m := range ms.all {
+		switch {
+		case m.offset >= end:
+			m.offset -= len(text)
+		case m.offset >= offset:
+			before, after := text[:m.offset-offset], text[m.offset-offset:]
+			if strings.Contains(after, "\n") || (atEnd && strings.Contains(before, "\n")) {
+				m.deleted = true
+				delete(ms.all, m)
+				continue
+			}
+			m.offset = offset
+		}
+	}
+}
@@ -0,0 +1,632 @@
+package editor
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/regex"
+)
+
+// motionKind says how much of the text between the cursor and the target of
+// a motion an operator acts on
+type motionKind int
+
+const (
+	// exclusive motions don't include the character at the target
+	exclusive motionKind = iota
+	// inclusive motions include the character at the target
+	inclusive
+	// linewise motions include every line between the cursor and the target
+	linewise
+)
+
+// region is the text an operator acts on. Charwise regions end before end;
+// linewise regions cover the full lines from start.row to end.row. Block
+// regions cover the columns from start.column to end.column, inclusive, on
+// each of those lines.
+type region struct {
+	start    Point
+	end      Point
+	linewise bool
+	block    bool
+}
+
+// textCursor steps through a buffer a character at a time. The end of each
+// line counts as a newline character, which is also the only character of an
+// empty line.
+type textCursor struct {
+	buffer Buffer
+	row    int
+	column int
+	line   string
+}
+
+func newTextCursor(b Buffer, p Point) *textCursor {
+	c := &textCursor{buffer: b, row: p.row}
+	c.line, _ = bufferLine(b, p.row)
+	c.column = max(1, min(p.column, len(c.line)+1))
+	return c
+}
+
+// bufferLine returns the content of the given 1-based line
+func bufferLine(b Buffer, row int) (string, bool) {
+	lines := b.LinesInRange(LineRange{int64(row), int64(row)})
+	if row < 1 || len(lines) == 0 {
+		return "", false
+	}
+	return lines[0].content, true
+}
+
+func (c *textCursor) point() Point {
+	return Point{row: c.row, column: c.column}
+}
+
+// char returns the character under the cursor
+func (c *textCursor) char() rune {
+	if c.column > len(c.line) {
+		return '\n'
+	}
+	r, _ := utf8.DecodeRuneInString(c.line[c.column-1:])
+	return r
+}
+
+// next moves to the next character, returning false at the end of the buffer
+func (c *textCursor) next() bool {
+	if c.column <= len(c.line) {
+		_, size := utf8.DecodeRuneInString(c.line[c.column-1:])
+		c.column += size
+		// The final line has no newline to stop on
+		if c.column > len(c.line) {
+			if _, ok := bufferLine(c.buffer, c.row+1); !ok {
+				c.column -= size
+				return false
+			}
+		}
+		return true
+	}
+	line, ok := bufferLine(c.buffer, c.row+1)
+	if !ok {
+		return false
+	}
+	c.row++
+	c.line = line
+	c.column = 1
+	return true
+}
+
+// prev moves to the previous character, returning false at the start of the
+// buffer
+func (c *textCursor) prev() bool {
+	if c.column > 1 {
+		_, size := utf8.DecodeLastRuneInString(c.line[:c.column-1])
+		c.column -= size
+		return true
+	}
+	line, ok := bufferLine(c.buffer, c.row-1)
+	if !ok {
+		return false
+	}
+	c.row--
+	c.line = line
+	// Empty lines stop on their newline, other lines on their last character
+	c.column = len(line) + 1
+	if len(line) > 0 {
+		_, size := utf8.DecodeLastRuneInString(line)
+		c.column -= size
+	}
+	return true
+}
+
+// atEmptyLine reports whether the cursor is on an empty line
+func (c *textCursor) atEmptyLine() bool {
+	return c.line == ""
+}
+
+// charClass groups characters into the runs that make up words: whitespace,
+// punctuation and keyword characters
+func charClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 2
+	}
+	return 1
+}
+
+// firstNonBlank returns the column of the first non-blank character of line
+func firstNonBlank(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t")) + 1
+}
+
+// moveColumn returns the column delta characters after column on line, or
+// before it if delta is negative. It stops at the start of the line and just
+// past its end, and moves a column inside a character to the character's start.
+func moveColumn(line string, column, delta int) int {
+	offset := min(max(column-1, 0), len(line))
+	for offset > 0 && offset < len(line) && !utf8.RuneStart(line[offset]) {
+		offset--
+	}
+	for ; delta > 0 && offset < len(line); delta-- {
+		_, size := utf8.DecodeRuneInString(line[offset:])
+		offset += size
+	}
+	for ; delta < 0 && offset > 0; delta++ {
+		_, size := utf8.DecodeLastRuneInString(line[:offset])
+		offset -= size
+	}
+	return offset + 1
+}
+
+// motionTarget returns where a motion moves the cursor from p and how an
+// operator treats the text in between. Count is 0 if no count was given. It
+// returns false if the motion fails, such as f not finding its character.
+func motionTarget(b Buffer, p Point, m command.Motion, count int) (Point, motionKind, bool) {
+	n := max(count, 1)
+	switch m := m.(type) {
+	case command.MoveCursorRelative:
+		if m.DeltaRows != 0 {
+			row := p.row + m.DeltaRows*n
+			if row < 1 {
+				row = 1
+			}
+			if _, ok := bufferLine(b, row); !ok {
+				row = b.LineCount()
+			}
+			return Point{row: row, column: p.column}, linewise, row != p.row
+		}
+		line, _ := bufferLine(b, p.row)
+		column := moveColumn(line, p.column, m.DeltaColumns*n)
+		return Point{row: p.row, column: column}, exclusive, column != p.column
+	case command.WordForward:
+		c := newTextCursor(b, p)
+		for i := 0; i < n; i++ {
+			if !wordForward(c) {
+				// Moving past the last word ends at the end of the buffer
+				c.column = len(c.line) + 1
+				break
+			}
+		}
+		return c.point(), exclusive, true
+	case command.WordEnd:
+		c := newTextCursor(b, p)
+		for i := 0; i < n; i++ {
+			if !wordEnd(c) {
+				break
+			}
+		}
+		return c.point(), inclusive, c.point() != p
+	case command.WordBackward:
+		c := newTextCursor(b, p)
+		for i := 0; i < n; i++ {
+			if !wordBackward(c) {
+				break
+			}
+		}
+		return c.point(), exclusive, c.point() != p
+	case command.LineStart:
+		return Point{row: p.row, column: 1}, exclusive, true
+	case command.LineEnd:
+		row := p.row + n - 1
+		line, ok := bufferLine(b, row)
+		if !ok {
+			return p, inclusive, false
+		}
+		column := len(line)
+		if len(line) > 0 {
+			_, size := utf8.DecodeLastRuneInString(line)
+			column = len(line) - size + 1
+		}
+		return Point{row: row, column: max(column, 1)}, inclusive, true
+	case command.GotoLine:
+		row := m.Line
+		if count > 0 {
+			row = count
+		}
+		if _, ok := bufferLine(b, row); !ok {
+			row = b.LineCount()
+		}
+		line, _ := bufferLine(b, row)
+		return Point{row: row, column: firstNonBlank(line)}, linewise, true
+	case command.GotoMark:
+		offset, ok := b.Marks().Get(m.Name)
+		if !ok {
+			return p, exclusive, false
+		}
+		target := b.PointAt(offset)
+		if m.Line {
+			line, _ := bufferLine(b, target.row)
+			return Point{row: target.row, column: firstNonBlank(line)}, linewise, true
+		}
+		return target, exclusive, true
+	case command.Lines:
+		row := p.row + n - 1
+		if _, ok := bufferLine(b, row); !ok {
+			row = b.LineCount()
+		}
+		return Point{row: row, column: p.column}, linewise, true
+	case command.FindChar:
+		return findChar(b, p, m, n)
+	case command.MatchPair:
+		return matchPair(b, p)
+	case command.Search:
+		re, err := regex.Compile(m.Pattern, false, false)
+		if err != nil {
+			return p, exclusive, false
+		}
+		target, ok := searchTarget(b, p, re, m.Backward, n)
+		return target, exclusive, ok
+	}
+	return p, exclusive, false
+}
+
+// wordForward moves to the start of the next word. Empty lines count as
+// words.
+func wordForward(c *textCursor) bool {
+	if class := charClass(c.char()); class != 0 {
+		for charClass(c.char()) == class && c.char() != '\n' {
+			if !c.next() {
+				return false
+			}
+		}
+	}
+	for charClass(c.char()) == 0 {
+		row := c.row
+		if !c.next() {
+			return false
+		}
+		if c.row != row && c.atEmptyLine() {
+			return true
+		}
+	}
+	return true
+}
+
+// wordEnd moves to the last character of the current or next word
+func wordEnd(c *textCursor) bool {
+	if !c.next() {
+		return false
+	}
+	for charClass(c.char()) == 0 {
+		if !c.next() {
+			return false
+		}
+	}
+	class := charClass(c.char())
+	for {
+		next := *c
+		if !next.next() || charClass(next.char()) != class || next.row != c.row {
+			return true
+		}
+		*c = next
+	}
+}
+
+// wordBackward moves to the start of the current or previous word. Empty
+// lines count as words.
+func wordBackward(c *textCursor) bool {
+	if !c.prev() {
+		return false
+	}
+	for charClass(c.char()) == 0 && !c.atEmptyLine() {
+		if !c.prev() {
+			return true
+		}
+	}
+	if c.atEmptyLine() {
+		return true
+	}
+	class := charClass(c.char())
+	for {
+		prev := *c
+		if !prev.prev() || charClass(prev.char()) != class || prev.row != c.row {
+			return true
+		}
+		*c = prev
+	}
+}
+
+// findChar finds the nth occurrence of a character in the line
+func findChar(b Buffer, p Point, m command.FindChar, n int) (Point, motionKind, bool) {
+	line, _ := bufferLine(b, p.row)
+	column := p.column
+	for i := 0; i < n; i++ {
+		var found int
+		if m.Backward {
+			found = strings.LastIndex(line[:max(0, min(column-1, len(line)))], string(m.Char))
+		} else {
+			start := min(column, len(line))
+			if column <= len(line) {
+				_, size := utf8.DecodeRuneInString(line[column-1:])
+				start = column - 1 + size
+			}
+			found = strings.Index(line[start:], string(m.Char))
+			if found >= 0 {
+				found += start
+			}
+		}
+		if found < 0 {
+			return p, inclusive, false
+		}
+		column = found + 1
+	}
+
+	if !m.Till {
+		if m.Backward {
+			return Point{row: p.row, column: column}, exclusive, true
+		}
+		return Point{row: p.row, column: column}, inclusive, true
+	}
+	if m.Backward {
+		return Point{row: p.row, column: column + utf8.RuneLen(m.Char)}, exclusive, true
+	}
+	_, size := utf8.DecodeLastRuneInString(line[:column-1])
+	return Point{row: p.row, column: column - size}, inclusive, true
+}
+
+var bracketPairs = map[rune]rune{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+
+// matchPair finds the bracket matching the first bracket at or after the
+// cursor in the line
+func matchPair(b Buffer, p Point) (Point, motionKind, bool) {
+	c := newTextCursor(b, p)
+	for {
+		if _, ok := bracketPairs[c.char()]; ok {
+			break
+		}
+		if c.char() == '\n' || !c.next() || c.row != p.row {
+			return p, inclusive, false
+		}
+	}
+	open := c.char()
+	forward := strings.ContainsRune("([{", open)
+	if target, ok := findMatching(c, open, bracketPairs[open], forward); ok {
+		return target, inclusive, true
+	}
+	return p, inclusive, false
+}
+
+// findMatching moves from a bracket to the bracket closing it, skipping over
+// nested pairs
+func findMatching(c *textCursor, open, close rune, forward bool) (Point, bool) {
+	depth := 0
+	for {
+		switch c.char() {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return c.point(), true
+			}
+		}
+		var moved bool
+		if forward {
+			moved = c.next()
+		} else {
+			moved = c.prev()
+		}
+		if !moved {
+			return Point{}, false
+		}
+	}
+}
+
+// motionRegion converts a motion from p to target into the region an
+// operator acts on
+func motionRegion(b Buffer, p, target Point, kind motionKind) region {
+	start, end := p, target
+	if end.row < start.row || (end.row == start.row && end.column < start.column) {
+		start, end = end, start
+	}
+	switch kind {
+	case linewise:
+		return region{start: start, end: end, linewise: true}
+	case inclusive:
+		line, _ := bufferLine(b, end.row)
+		if end.column <= len(line) {
+			_, size := utf8.DecodeRuneInString(line[end.column-1:])
+			end.column += size
+		}
+	}
+	return region{start: start, end: end}
+}
+
+// textObjectRegion returns the region a text object selects around p
+func textObjectRegion(b Buffer, p Point, obj command.TextObject, count int) (region, bool) {
+	n := max(count, 1)
+	switch obj := obj.(type) {
+	case command.SelectWord:
+		return selectWord(b, p, obj.Inner, n)
+	case command.SelectQuoted:
+		return selectQuoted(b, p, obj.Quote, obj.Inner)
+	case command.SelectBlock:
+		return selectBlock(b, p, obj.Open, obj.Close, obj.Inner, n)
+	case command.SelectParagraph:
+		return selectParagraph(b, p, obj.Inner, n)
+	}
+	return region{}, false
+}
+
+// selectWord selects n words or runs of whitespace within the line
+func selectWord(b Buffer, p Point, inner bool, n int) (region, bool) {
+	line, _ := bufferLine(b, p.row)
+	if line == "" {
+		return region{}, false
+	}
+	runes := []rune(line)
+	// Convert the byte column to a rune index
+	i := utf8.RuneCountInString(line[:min(p.column-1, len(line))])
+	i = min(i, len(runes)-1)
+
+	// run returns the end of the run of characters of the same class at j
+	run := func(j int) int {
+		class := charClass(runes[j])
+		for j < len(runes) && charClass(runes[j]) == class {
+			j++
+		}
+		return j
+	}
+	start := i
+	for start > 0 && charClass(runes[start-1]) == charClass(runes[i]) {
+		start--
+	}
+	end := i
+	for k := 0; k < n && end < len(runes); k++ {
+		startedOnSpace := charClass(runes[end]) == 0
+		end = run(end)
+		// aw includes the whitespace after the word, or before it if there is none
+		if !inner && !startedOnSpace {
+			if end < len(runes) && charClass(runes[end]) == 0 {
+				end = run(end)
+			} else if k == n-1 {
+				for start > 0 && charClass(runes[start-1]) == 0 {
+					start--
+				}
+			}
+		} else if !inner && startedOnSpace && end < len(runes) {
+			end = run(end)
+		}
+	}
+	return region{
+		start: Point{row: p.row, column: len(string(runes[:start])) + 1},
+		end:   Point{row: p.row, column: len(string(runes[:end])) + 1},
+	}, true
+}
+
+// selectQuoted selects a quoted string in the line. The cursor may be inside
+// the quotes or before the opening quote.
+func selectQuoted(b Buffer, p Point, quote rune, inner bool) (region, bool) {
+	line, _ := bufferLine(b, p.row)
+	q := string(quote)
+	column := p.column - 1
+	var quotes []int
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if r == '\\' {
+			i += size + 1
+			continue
+		}
+		if r == quote {
+			quotes = append(quotes, i)
+		}
+		i += size
+	}
+	// Quotes pair up from the start of the line
+	open, close := -1, -1
+	for k := 0; k+1 < len(quotes); k += 2 {
+		if column <= quotes[k+1] {
+			open, close = quotes[k], quotes[k+1]
+			break
+		}
+	}
+	if open < 0 {
+		return region{}, false
+	}
+	start, end := open+len(q), close
+	if !inner {
+		start, end = open, close+len(q)
+		// Include the whitespace after the closing quote, or before the
+		// opening one if there is none
+		if trailing := len(line[end:]) - len(strings.TrimLeft(line[end:], " \t")); trailing > 0 {
+			end += trailing
+		} else {
+			start -= len(line[:start]) - len(strings.TrimRight(line[:start], " \t"))
+		}
+	}
+	return region{start: Point{row: p.row, column: start + 1}, end: Point{row: p.row, column: end + 1}}, true
+}
+
+// selectBlock selects the nth enclosing block delimited by open and close
+func selectBlock(b Buffer, p Point, open, close rune, inner bool, n int) (region, bool) {
+	c := newTextCursor(b, p)
+	for i := 0; i < n; i++ {
+		// Find the unmatched opening bracket before the cursor. On the first
+		// level the cursor may be on the opening bracket itself.
+		if i > 0 || c.char() != open {
+			if c.char() == close && i == 0 {
+				if !c.prev() {
+					return region{}, false
+				}
+			}
+			depth := 0
+			for {
+				if ch := c.char(); ch == close {
+					depth++
+				} else if ch == open {
+					if depth == 0 {
+						break
+					}
+					depth--
+				}
+				if !c.prev() {
+					return region{}, false
+				}
+			}
+		}
+		if i < n-1 && !c.prev() {
+			return region{}, false
+		}
+	}
+	start := c.point()
+	end, ok := findMatching(c, open, close, true)
+	if !ok {
+		return region{}, false
+	}
+	if inner {
+		start.column += utf8.RuneLen(open)
+		// A block whose brackets are on lines of their own covers the full
+		// lines in between
+		startLine, _ := bufferLine(b, start.row)
+		endLine, _ := bufferLine(b, end.row)
+		if start.column > len(startLine) && strings.TrimSpace(endLine[:end.column-1]) == "" && end.row-start.row > 1 {
+			return region{start: Point{row: start.row + 1, column: 1}, end: Point{row: end.row - 1, column: 1}, linewise: true}, true
+		}
+		return region{start: start, end: end}, true
+	}
+	end.column += utf8.RuneLen(close)
+	return region{start: start, end: end}, true
+}
+
+// selectParagraph selects n paragraphs, which are runs of non-blank lines or
+// runs of blank lines
+func selectParagraph(b Buffer, p Point, inner bool, n int) (region, bool) {
+	blank := func(row int) (bool, bool) {
+		line, ok := bufferLine(b, row)
+		return strings.TrimSpace(line) == "", ok
+	}
+	isBlank, _ := blank(p.row)
+	start := p.row
+	for start > 1 {
+		if prev, _ := blank(start - 1); prev != isBlank {
+			break
+		}
+		start--
+	}
+	end := p.row
+	runs := n
+	if !inner {
+		// ap also covers the run after the paragraph
+		runs = n * 2
+	}
+	current := isBlank
+	for k := 0; k < runs; k++ {
+		for {
+			next, ok := blank(end + 1)
+			if !ok || next != current {
+				break
+			}
+			end++
+		}
+		if k < runs-1 {
+			if _, ok := blank(end + 1); !ok {
+				break
+			}
+			end++
+			current = !current
+		}
+	}
+	return region{start: Point{row: start, column: 1}, end: Point{row: end, column: 1}, linewise: true}, true
+}
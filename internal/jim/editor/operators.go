@@ -0,0 +1,287 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/modes"
+	"github.com/jstotz/jim/internal/jim/registers"
+)
+
+// tabStop is the number of columns a tab advances to when measuring
+// indentation
+const tabStop = 8
+
+// operatorTarget returns the motion or text object an operator-pending
+// command supplies and the count typed before it
+func operatorTarget(cmd command.Command) (command.Command, int, bool) {
+	count := 0
+	if r, ok := cmd.(command.Repeat); ok {
+		cmd, count = r.Command, r.Count
+	}
+	switch cmd.(type) {
+	case command.Motion, command.TextObject:
+		return cmd, count, true
+	}
+	return nil, 0, false
+}
+
+// completeOperator applies the pending operator to the target typed in
+// operator-pending mode. Counts typed before the operator and before the
+// target multiply.
+func (e *Editor) completeOperator(target command.Command, count int) error {
+	op := e.operator
+	if op.Count > 0 || count > 0 {
+		count = max(op.Count, 1) * max(count, 1)
+	}
+	if err := e.activateMode(modes.ModeNormal); err != nil {
+		return err
+	}
+	return e.applyOperator(command.ApplyOperator{Operator: op.Operator, Target: target, Count: count})
+}
+
+// moveCursor moves the cursor of the focused window with a motion
+func (e *Editor) moveCursor(m command.Motion, count int) {
+	w := e.FocusedWindow()
+	m, from, ok := e.resolveSearch(w.buffer, w.CurrentPosition(), m)
+	if !ok {
+		return
+	}
+	target, _, ok := motionTarget(w.buffer, from, m, count)
+	e.reportSearch(w.buffer, m, from, target, ok)
+	if !ok {
+		return
+	}
+	target.column = min(target.column, w.lineLength(target.row)+1)
+	// In visual mode $ selects up to and including the end of the line
+	if _, ok := m.(command.LineEnd); ok && e.mode.IsVisual() {
+		target.column = w.lineLength(target.row) + 1
+	}
+	w.SetPosition(target)
+}
+
+func (e *Editor) applyOperator(cmd command.ApplyOperator) error {
+	w := e.FocusedWindow()
+	p := w.CurrentPosition()
+	var r region
+	switch target := cmd.Target.(type) {
+	case command.TextObject:
+		var ok bool
+		if r, ok = textObjectRegion(w.buffer, p, target, cmd.Count); !ok {
+			return nil
+		}
+	case command.Motion:
+		target, _, ok := e.resolveSearch(w.buffer, p, target)
+		if !ok {
+			return nil
+		}
+		if r, ok = operatorMotionRegion(w.buffer, p, cmd.Operator, target, cmd.Count); !ok {
+			e.reportSearch(w.buffer, target, p, p, false)
+			return nil
+		}
+	default:
+		return fmt.Errorf("operator target is not a motion or text object: %#v", cmd.Target)
+	}
+	return e.operate(w, cmd.Operator, r)
+}
+
+// operatorMotionRegion returns the region an operator acts on for a motion,
+// applying Vim's special cases for w
+func operatorMotionRegion(b Buffer, p Point, op command.Operator, m command.Motion, count int) (region, bool) {
+	if _, ok := m.(command.WordForward); ok {
+		c := newTextCursor(b, p)
+		if op == command.OperatorChange && charClass(c.char()) != 0 {
+			// cw changes to the end of the word like ce. On the last character
+			// of a word that word is already the first one changed.
+			n := max(count, 1)
+			next := *c
+			if !next.next() || next.row != c.row || charClass(next.char()) != charClass(c.char()) {
+				n--
+			}
+			if n == 0 {
+				return motionRegion(b, p, p, inclusive), true
+			}
+			target, kind, ok := motionTarget(b, p, command.WordEnd{}, n)
+			return motionRegion(b, p, target, kind), ok
+		}
+
+		target, kind, ok := motionTarget(b, p, m, count)
+		if !ok {
+			return region{}, false
+		}
+		// When the last word moved over is at the end of a line, the
+		// operator stops there instead of at the start of the next line
+		if line, _ := bufferLine(b, target.row); target.row > p.row && target.column <= firstNonBlank(line) {
+			prev, _ := bufferLine(b, target.row-1)
+			target = Point{row: target.row - 1, column: len(prev) + 1}
+		}
+		return motionRegion(b, p, target, kind), true
+	}
+
+	target, kind, ok := motionTarget(b, p, m, count)
+	if !ok {
+		return region{}, false
+	}
+	return motionRegion(b, p, target, kind), true
+}
+
+// regionOffsets returns the byte offsets of a region. Linewise regions
+// include the newline ending their last line if there is one.
+func regionOffsets(b Buffer, r region) (start, end int) {
+	if r.linewise {
+		return b.Offset(Point{row: r.start.row, column: 1}), b.Offset(Point{row: r.end.row + 1, column: 1})
+	}
+	return b.Offset(r.start), b.Offset(r.end)
+}
+
+// isLastLine reports whether row is the last line of the buffer
+func isLastLine(b Buffer, row int) bool {
+	_, ok := bufferLine(b, row+1)
+	return !ok
+}
+
+// operate applies an operator to a region of the window's buffer
+func (e *Editor) operate(w *Window, op command.Operator, r region) error {
+	b := w.buffer
+	name := e.takeRegister()
+	start, end := regionOffsets(b, r)
+	reg := registers.Register{Text: b.Slice(start, end)}
+	if r.linewise {
+		reg.Type = registers.Linewise
+		if !strings.HasSuffix(reg.Text, "\n") {
+			reg.Text += "\n"
+		}
+	}
+
+	switch op {
+	case command.OperatorYank:
+		e.storeRegister(name, op, reg)
+		if r.linewise {
+			w.SetPosition(Point{row: r.start.row, column: min(w.CurrentPosition().column, w.lineLength(r.start.row)+1)})
+		} else {
+			w.SetPosition(r.start)
+		}
+	case command.OperatorDelete:
+		e.storeRegister(name, op, reg)
+		if r.linewise && isLastLine(b, r.end.row) && start > 0 {
+			// Deleting the last lines also deletes the newline before them
+			start--
+		}
+		if err := w.DeleteText(b.PointAt(start), end-start); err != nil {
+			return err
+		}
+		if r.linewise {
+			row := min(r.start.row, b.LineCount())
+			line, _ := bufferLine(b, row)
+			w.SetPosition(Point{row: row, column: firstNonBlank(line)})
+		} else {
+			w.SetPosition(b.PointAt(start))
+		}
+	case command.OperatorChange:
+		e.storeRegister(name, op, reg)
+		if r.linewise && !isLastLine(b, r.end.row) {
+			// Keep an empty line to type the replacement on
+			end--
+		}
+		// Enter insert mode first so the deletion is undone together with the
+		// text typed in its place
+		if err := e.activateMode(modes.ModeInsert); err != nil {
+			return err
+		}
+		if err := w.DeleteText(b.PointAt(start), end-start); err != nil {
+			return err
+		}
+		w.SetPosition(b.PointAt(start))
+	case command.OperatorIndent, command.OperatorDedent:
+		return shiftLines(w, r.start.row, r.end.row, op == command.OperatorIndent)
+	case command.OperatorLowercase, command.OperatorUppercase:
+		if r.linewise && strings.HasSuffix(b.Slice(start, end), "\n") {
+			end--
+		}
+		original := b.Slice(start, end)
+		converted := strings.ToLower(original)
+		if op == command.OperatorUppercase {
+			converted = strings.ToUpper(original)
+		}
+		if converted != original {
+			history := b.UndoTree()
+			history.BeginGroup()
+			err := replaceText(w, start, end, converted)
+			history.EndGroup()
+			if err != nil {
+				return err
+			}
+		}
+		w.SetPosition(b.PointAt(start))
+	}
+	return nil
+}
+
+// replaceText replaces the text between two offsets
+func replaceText(w *Window, start, end int, text string) error {
+	p := w.buffer.PointAt(start)
+	if err := w.DeleteText(p, end-start); err != nil {
+		return err
+	}
+	return w.InsertText(p, text)
+}
+
+// shiftLines indents or dedents the given lines by the buffer's shiftwidth
+// as a single undo step. Empty lines aren't indented.
+func shiftLines(w *Window, first, last int, indent bool) error {
+	opts := w.buffer.Options()
+	history := w.buffer.UndoTree()
+	history.BeginGroup()
+	defer history.EndGroup()
+
+	for row := first; row <= last; row++ {
+		line, ok := bufferLine(w.buffer, row)
+		if !ok {
+			break
+		}
+		leading := line[:firstNonBlank(line)-1]
+		if indent && line == "" {
+			continue
+		}
+		width := indentWidth(leading)
+		if indent {
+			width += opts.ShiftWidth
+		} else {
+			width = max(0, width-opts.ShiftWidth)
+		}
+		replacement := makeIndent(width, opts.ExpandTab)
+		if replacement == leading {
+			continue
+		}
+		start := w.buffer.Offset(Point{row: row, column: 1})
+		if err := replaceText(w, start, start+len(leading), replacement); err != nil {
+			return err
+		}
+	}
+	line, _ := bufferLine(w.buffer, first)
+	w.SetPosition(Point{row: first, column: firstNonBlank(line)})
+	return nil
+}
+
+// indentWidth returns the number of columns taken up by leading whitespace
+func indentWidth(leading string) int {
+	width := 0
+	for _, r := range leading {
+		if r == '\t' {
+			width += tabStop - width%tabStop
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// makeIndent returns whitespace that indents by width columns, using tabs
+// where possible unless expandTab is set
+func makeIndent(width int, expandTab bool) string {
+	if expandTab {
+		return strings.Repeat(" ", width)
+	}
+	return strings.Repeat("\t", width/tabStop) + strings.Repeat(" ", width%tabStop)
+}
@@ -0,0 +1,50 @@
+package editor
+
+import "testing"
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		text   string
+		keys   string
+		want   string
+		column int
+	}{
+		{"one two three", "dw", "two three", 1},
+		{"one two three", "2dw", "three", 1},
+		{"one two three", "d2w", "three", 1},
+		{"one two three", "wdw", "one three", 5},
+		{"one two", "wdw", "one ", 5},
+		{"one two three", "cwxyz<Esc>", "xyz two three", 4},
+		{"one two three", "2cwx<Esc>", "x three", 2},
+		{"one two three", "wd$", "one ", 5},
+		{"one two three", "d$", "", 1},
+		{"f(a, b) + 1", "fadi(", "f() + 1", 3},
+		{"f((a), b)", "fadi(", "f((), b)", 4},
+		{"f(a, b) + 1", "fada(", "f + 1", 2},
+		{`say "hi there" now`, `fhda"`, "say now", 5},
+		{`say "hi there" now`, `fhdi"`, `say "" now`, 6},
+		{"abc", "x", "bc", 1},
+		{"abc", "2x", "c", 1},
+		{"abc", "5x", "", 1},
+		{"abc", "$x", "ab", 3},
+		{"abc", "$X", "ac", 2},
+		{"abc", "$2X", "c", 1},
+		{"héllo", "lx", "hllo", 2},
+		{"héllo", "lllx", "hélo", 5},
+		{"héllo", "$hhX", "hllo", 2},
+		{"日本語", "l2x", "日", 4},
+		{"日本語", "$x", "日本", 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text+"/"+tt.keys, func(t *testing.T) {
+			e := newTestEditor(t, tt.text)
+			typeKeys(t, e, tt.keys)
+			if got := bufferText(e.window.buffer); got != tt.want {
+				t.Errorf("typing %s on %q gave %q, want %q", tt.keys, tt.text, got, tt.want)
+			}
+			if got := e.window.CurrentPosition().column; got != tt.column {
+				t.Errorf("typing %s on %q left the cursor in column %d, want %d", tt.keys, tt.text, got, tt.column)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/charset"
+)
+
+// FileFormat is the line ending style a buffer is written with
+type FileFormat int
+
+const (
+	FileFormatUnix FileFormat = iota
+	FileFormatDOS
+)
+
+func (f FileFormat) String() string {
+	return [...]string{"unix", "dos"}[f]
+}
+
+// lineEnding returns the characters that terminate each line
+func (f FileFormat) lineEnding() string {
+	if f == FileFormatDOS {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func parseFileFormat(s string) (FileFormat, error) {
+	switch s {
+	case "unix":
+		return FileFormatUnix, nil
+	case "dos":
+		return FileFormatDOS, nil
+	}
+	return FileFormatUnix, fmt.Errorf("invalid fileformat: %s", s)
+}
+
+// lineEndingWriter converts newlines to another line ending as it writes
+type lineEndingWriter struct {
+	w      io.Writer
+	ending string
+}
+
+func (lw *lineEndingWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			written, err := lw.w.Write(p)
+			return n + written, err
+		}
+		if _, err := lw.w.Write(p[:i]); err != nil {
+			return n, err
+		}
+		if _, err := io.WriteString(lw.w, lw.ending); err != nil {
+			return n, err
+		}
+		n += i + 1
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// detectFileFormat returns FileFormatDOS if every line in data ends with
+// CRLF. Files with mixed line endings are treated as unix files so that the
+// carriage returns are kept.
+func detectFileFormat(data []byte) FileFormat {
+	lines := bytes.Count(data, []byte("\n"))
+	if lines > 0 && bytes.Count(data, []byte("\r\n")) == lines {
+		return FileFormatDOS
+	}
+	return FileFormatUnix
+}
+
+// BufferOptions are the per-buffer settings that control how a buffer's
+// contents are edited and written
+type BufferOptions struct {
+	FileFormat FileFormat
+	// EndOfLine is whether the last line is terminated by a line ending
+	EndOfLine bool
+	// FileEncoding is the character encoding the file is converted to when written
+	FileEncoding charset.Encoding
+	// BOM is whether the file starts with a byte order mark
+	BOM bool
+	// ShiftWidth is the number of columns the > and < operators indent by
+	ShiftWidth int
+	// ExpandTab indents with spaces instead of tabs
+	ExpandTab bool
+}
+
+func defaultBufferOptions() BufferOptions {
+	return BufferOptions{
+		FileFormat:   FileFormatUnix,
+		EndOfLine:    true,
+		FileEncoding: charset.UTF8,
+		ShiftWidth:   8,
+	}
+}
+
+// setOption applies a :set argument, which is one of "name=value", "name",
+// "noname" or "name?" to show the current value, to the main window's buffer.
+// The search options ignorecase and smartcase apply to the whole editor.
+func (e *Editor) setOption(arg string) error {
+	opts := e.window.buffer.Options()
+	name, value, hasValue := strings.Cut(arg, "=")
+
+	if query, ok := strings.CutSuffix(name, "?"); ok {
+		switch query {
+		case "fileformat", "ff":
+			e.message = "fileformat=" + opts.FileFormat.String()
+		case "endofline", "eol":
+			e.message = boolOption("endofline", opts.EndOfLine)
+		case "fileencoding", "fenc":
+			e.message = "fileencoding=" + opts.FileEncoding.String()
+		case "bomb":
+			e.message = boolOption("bomb", opts.BOM)
+		case "shiftwidth", "sw":
+			e.message = "shiftwidth=" + strconv.Itoa(opts.ShiftWidth)
+		case "expandtab", "et":
+			e.message = boolOption("expandtab", opts.ExpandTab)
+		case "ignorecase", "ic":
+			e.message = boolOption("ignorecase", e.config.IgnoreCase)
+		case "smartcase", "scs":
+			e.message = boolOption("smartcase", e.config.SmartCase)
+		default:
+			return fmt.Errorf("unknown option: %s", query)
+		}
+		return nil
+	}
+
+	switch {
+	case (name == "fileformat" || name == "ff") && hasValue:
+		format, err := parseFileFormat(value)
+		if err != nil {
+			return err
+		}
+		opts.FileFormat = format
+	case (name == "endofline" || name == "eol") && !hasValue:
+		opts.EndOfLine = true
+	case (name == "noendofline" || name == "noeol") && !hasValue:
+		opts.EndOfLine = false
+	case (name == "fileencoding" || name == "fenc") && hasValue:
+		enc, err := charset.Parse(value)
+		if err != nil {
+			return err
+		}
+		opts.FileEncoding = enc
+	case name == "bomb" && !hasValue:
+		opts.BOM = true
+	case name == "nobomb" && !hasValue:
+		opts.BOM = false
+	case (name == "shiftwidth" || name == "sw") && hasValue:
+		width, err := strconv.Atoi(value)
+		if err != nil || width < 1 {
+			return fmt.Errorf("invalid shiftwidth: %s", value)
+		}
+		opts.ShiftWidth = width
+	case (name == "expandtab" || name == "et") && !hasValue:
+		opts.ExpandTab = true
+	case (name == "noexpandtab" || name == "noet") && !hasValue:
+		opts.ExpandTab = false
+	case (name == "ignorecase" || name == "ic") && !hasValue:
+		e.config.IgnoreCase = true
+	case (name == "noignorecase" || name == "noic") && !hasValue:
+		e.config.IgnoreCase = false
+	case (name == "smartcase" || name == "scs") && !hasValue:
+		e.config.SmartCase = true
+	case (name == "nosmartcase" || name == "noscs") && !hasValue:
+		e.config.SmartCase = false
+	default:
+		return fmt.Errorf("invalid option: %s", arg)
+	}
+	return nil
+}
+
+func boolOption(name string, value bool) string {
+	if value {
+		return name
+	}
+	return "no" + name
+}
@@ -0,0 +1,420 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	sourceOriginal = iota
+	sourceAdd
+)
+
+// unknownNewlines marks a piece whose newlines haven't been counted yet
+const unknownNewlines = -1
+
+// pieceSource is one of the backing stores of a piece table. Sources are
+// never modified in place: the original source is immutable and the add
+// source is append-only.
+type pieceSource interface {
+	// chunk returns a prefix of the bytes between start and end
+	chunk(start, end int) []byte
+	// indexed reports whether the newlines before end are known without
+	// reading more of the source
+	indexed(end int) bool
+	// countNewlines returns the number of newlines between start and end
+	countNewlines(start, end int) int
+	// nthNewline returns the offset of the nth (1-based) newline at or after
+	// start, or -1 if there are fewer than n newlines before limit
+	nthNewline(start, n, limit int) int
+}
+
+// memorySource is a piece source held in memory along with the offsets of
+// every newline it contains
+type memorySource struct {
+	data     []byte
+	newlines []int
+}
+
+func newMemorySource(data []byte) *memorySource {
+	s := &memorySource{}
+	s.append(data)
+	return s
+}
+
+func (s *memorySource) append(data []byte) (start int) {
+	start = len(s.data)
+	for i, b := range data {
+		if b == '\n' {
+			s.newlines = append(s.newlines, start+i)
+		}
+	}
+	s.data = append(s.data, data...)
+	return start
+}
+
+func (s *memorySource) chunk(start, end int) []byte {
+	return s.data[start:end]
+}
+
+func (s *memorySource) indexed(end int) bool {
+	return true
+}
+
+func (s *memorySource) countNewlines(start, end int) int {
+	return sort.SearchInts(s.newlines, end) - sort.SearchInts(s.newlines, start)
+}
+
+func (s *memorySource) nthNewline(start, n, limit int) int {
+	i := sort.SearchInts(s.newlines, start) + n - 1
+	if i >= len(s.newlines) || s.newlines[i] >= limit {
+		return -1
+	}
+	return s.newlines[i]
+}
+
+// piece is a span of one of the piece table sources
+type piece struct {
+	source int
+	start  int
+	length int
+	// newlines is the number of newlines in the piece, or unknownNewlines
+	// if counting them would mean reading a lazily indexed source
+	newlines int
+}
+
+// pieceTable is a text storage structure that represents a document as a
+// list of pieces over an original and an add buffer. Inserting or deleting
+// only splits pieces instead of copying the document, and newline counts are
+// cached per piece so that line lookups don't need to scan the text.
+type pieceTable struct {
+	original pieceSource
+	add      *memorySource
+	pieces   []piece
+	length   int
+	// newlines is the total number of newlines in the document, or
+	// unknownNewlines if some pieces haven't been counted
+	newlines int
+}
+
+func newPieceTable(original []byte) *pieceTable {
+	return newPieceTableFromSource(newMemorySource(original), len(original))
+}
+
+func newPieceTableFromSource(original pieceSource, length int) *pieceTable {
+	pt := &pieceTable{
+		original: original,
+		add:      newMemorySource(nil),
+		length:   length,
+	}
+	if length > 0 {
+		pt.pieces = []piece{pt.newPiece(sourceOriginal, 0, length)}
+	}
+	pt.updateTotals()
+	return pt
+}
+
+func (pt *pieceTable) source(source int) pieceSource {
+	if source == sourceAdd {
+		return pt.add
+	}
+	return pt.original
+}
+
+func (pt *pieceTable) newPiece(source, start, length int) piece {
+	p := piece{source: source, start: start, length: length, newlines: unknownNewlines}
+	if src := pt.source(source); src.indexed(start + length) {
+		p.newlines = src.countNewlines(start, start+length)
+	}
+	return p
+}
+
+// pieceNewlines returns the number of newlines in the piece at index,
+// counting them if they aren't known yet
+func (pt *pieceTable) pieceNewlines(index int) int {
+	p := &pt.pieces[index]
+	if p.newlines == unknownNewlines {
+		p.newlines = pt.source(p.source).countNewlines(p.start, p.start+p.length)
+	}
+	return p.newlines
+}
+
+func (pt *pieceTable) updateTotals() {
+	pt.length = 0
+	pt.newlines = 0
+	for _, p := range pt.pieces {
+		pt.length += p.length
+		if p.newlines == unknownNewlines || pt.newlines == unknownNewlines {
+			pt.newlines = unknownNewlines
+		} else {
+			pt.newlines += p.newlines
+		}
+	}
+}
+
+// Len returns the length of the document in bytes
+func (pt *pieceTable) Len() int {
+	return pt.length
+}
+
+// LineCount returns the number of lines in the document. An empty document
+// has a single empty line. For lazily indexed documents this reads the
+// whole document the first time.
+func (pt *pieceTable) LineCount() int {
+	if pt.newlines == unknownNewlines {
+		pt.newlines = 0
+		for i := range pt.pieces {
+			pt.newlines += pt.pieceNewlines(i)
+		}
+	}
+	return pt.newlines + 1
+}
+
+// HasLine reports whether the given 0-based line exists, only reading as
+// much of a lazily indexed document as needed
+func (pt *pieceTable) HasLine(line int) bool {
+	if pt.newlines != unknownNewlines {
+		return line >= 0 && line < pt.newlines+1
+	}
+	return line == 0 || pt.lineStart(line) >= 0
+}
+
+// locate returns the index of the piece containing offset and the offset
+// within that piece. An offset at the end of the document returns the
+// number of pieces.
+func (pt *pieceTable) locate(offset int) (index int, pieceOffset int) {
+	for i, p := range pt.pieces {
+		if offset < p.length {
+			return i, offset
+		}
+		offset -= p.length
+	}
+	return len(pt.pieces), offset
+}
+
+// Insert inserts text at the given byte offset
+func (pt *pieceTable) Insert(offset int, text string) {
+	if len(text) == 0 {
+		return
+	}
+	start := pt.add.append([]byte(text))
+	inserted := pt.newPiece(sourceAdd, start, len(text))
+	pt.length += len(text)
+	if pt.newlines != unknownNewlines {
+		pt.newlines += inserted.newlines
+	}
+
+	index, pieceOffset := pt.locate(offset)
+
+	// Typing sequential characters appends to the add buffer right after the
+	// previous insert, so extend that piece instead of creating a new one.
+	if pieceOffset == 0 && index > 0 {
+		prev := &pt.pieces[index-1]
+		if prev.source == sourceAdd && prev.start+prev.length == start {
+			prev.length += inserted.length
+			prev.newlines += inserted.newlines
+			return
+		}
+	}
+
+	if pieceOffset == 0 {
+		pt.pieces = append(pt.pieces, piece{})
+		copy(pt.pieces[index+1:], pt.pieces[index:])
+		pt.pieces[index] = inserted
+		return
+	}
+
+	p := pt.pieces[index]
+	left := pt.newPiece(p.source, p.start, pieceOffset)
+	right := pt.newPiece(p.source, p.start+pieceOffset, p.length-pieceOffset)
+	pt.pieces = append(pt.pieces, piece{}, piece{})
+	copy(pt.pieces[index+3:], pt.pieces[index+1:])
+	pt.pieces[index] = left
+	pt.pieces[index+1] = inserted
+	pt.pieces[index+2] = right
+	pt.updateTotals()
+}
+
+// Delete removes length bytes starting at the given byte offset
+func (pt *pieceTable) Delete(offset int, length int) {
+	if length <= 0 {
+		return
+	}
+	end := offset + length
+	var pieces []piece
+	pos := 0
+	for _, p := range pt.pieces {
+		pieceStart, pieceEnd := pos, pos+p.length
+		pos = pieceEnd
+		if pieceEnd <= offset || pieceStart >= end {
+			pieces = append(pieces, p)
+			continue
+		}
+		if pieceStart < offset {
+			pieces = append(pieces, pt.newPiece(p.source, p.start, offset-pieceStart))
+		}
+		if pieceEnd > end {
+			skip := end - pieceStart
+			pieces = append(pieces, pt.newPiece(p.source, p.start+skip, p.length-skip))
+		}
+	}
+	pt.pieces = pieces
+	pt.updateTotals()
+}
+
+// LineStart returns the byte offset of the first character of the given
+// 0-based line. Lines past the end of the document return the document length.
+func (pt *pieceTable) LineStart(line int) int {
+	if start := pt.lineStart(line); start >= 0 {
+		return start
+	}
+	return pt.length
+}
+
+// lineStart returns the byte offset of the given 0-based line, or -1 if the
+// document has fewer lines
+func (pt *pieceTable) lineStart(line int) int {
+	if line <= 0 {
+		return 0
+	}
+	offset := 0
+	for i, p := range pt.pieces {
+		src := pt.source(p.source)
+		if p.newlines == unknownNewlines {
+			// Only index as far as the line we're looking for
+			if nl := src.nthNewline(p.start, line, p.start+p.length); nl >= 0 {
+				return offset + nl - p.start + 1
+			}
+		} else if line <= p.newlines {
+			nl := src.nthNewline(p.start, line, p.start+p.length)
+			return offset + nl - p.start + 1
+		}
+		line -= pt.pieceNewlines(i)
+		offset += p.length
+	}
+	return -1
+}
+
+// LineEnd returns the byte offset of the newline terminating the given
+// 0-based line, or the document length for the last line.
+func (pt *pieceTable) LineEnd(line int) int {
+	if next := pt.lineStart(line + 1); next >= 0 {
+		return next - 1
+	}
+	return pt.length
+}
+
+// Position returns the 0-based line containing the given byte offset and the
+// offset of the byte within that line
+func (pt *pieceTable) Position(offset int) (line int, column int) {
+	offset = max(0, min(offset, pt.length))
+	index, pieceOffset := pt.locate(offset)
+	for i := range pt.pieces[:index] {
+		line += pt.pieceNewlines(i)
+	}
+	if index < len(pt.pieces) {
+		p := pt.pieces[index]
+		line += pt.source(p.source).countNewlines(p.start, p.start+pieceOffset)
+	}
+	return line, offset - pt.LineStart(line)
+}
+
+// Slice returns the text between the start and end byte offsets
+func (pt *pieceTable) Slice(start, end int) string {
+	if end > pt.length {
+		end = pt.length
+	}
+	if start >= end {
+		return ""
+	}
+	var sb strings.Builder
+	sb.Grow(end - start)
+	pt.each(start, func(data []byte) bool {
+		if len(data) > end-start {
+			data = data[:end-start]
+		}
+		sb.Write(data)
+		start += len(data)
+		return start < end
+	})
+	return sb.String()
+}
+
+// Lines returns the content of up to count lines starting at the given
+// 0-based line, without their trailing newlines
+func (pt *pieceTable) Lines(line int, count int) []string {
+	if count <= 0 {
+		return nil
+	}
+	start := pt.lineStart(line)
+	if start < 0 {
+		return nil
+	}
+	var lines []string
+	var current []byte
+	pt.each(start, func(data []byte) bool {
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				current = append(current, data...)
+				return true
+			}
+			current = append(current, data[:i]...)
+			lines = append(lines, string(current))
+			current = current[:0]
+			data = data[i+1:]
+			if len(lines) == count {
+				return false
+			}
+		}
+		return true
+	})
+	if len(lines) < count && pt.HasLine(line+len(lines)) {
+		lines = append(lines, string(current))
+	}
+	return lines
+}
+
+// each calls fn with consecutive chunks of the document starting at offset,
+// stopping early if a source can't provide the rest of its pieces
+// until fn returns false or the end of the document is reached
+func (pt *pieceTable) each(offset int, fn func(data []byte) bool) {
+	index, pieceOffset := pt.locate(offset)
+	for _, p := range pt.pieces[index:] {
+		src := pt.source(p.source)
+		for start, end := p.start+pieceOffset, p.start+p.length; start < end; {
+			data := src.chunk(start, end)
+			if len(data) == 0 {
+				// A file source ends early if the file was truncated
+				return
+			}
+			start += len(data)
+			if !fn(data) {
+				return
+			}
+		}
+		pieceOffset = 0
+	}
+}
+
+// WriteTo writes the full document to w a chunk at a time
+func (pt *pieceTable) WriteTo(w io.Writer) (n int64, err error) {
+	pt.each(0, func(data []byte) bool {
+		var written int
+		written, err = w.Write(data)
+		n += int64(written)
+		return err == nil
+	})
+	if err == nil && n < int64(pt.length) {
+		err = fmt.Errorf("piece table write: %w", io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// String returns the full document text
+func (pt *pieceTable) String() string {
+	return pt.Slice(0, pt.length)
+}
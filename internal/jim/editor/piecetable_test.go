@@ -0,0 +1,215 @@
+package editor
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// splitTable returns a piece table holding "one\ntwo\nthree\n" in three
+// pieces, the middle one from the add source
+func splitTable() *pieceTable {
+	pt := newPieceTable([]byte("one\nthree\n"))
+	pt.Insert(4, "two\n")
+	return pt
+}
+
+func TestPieceTableInsert(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+		text   string
+		want   string
+	}{
+		{"start", 0, "zero\n", "zero\none\ntwo\nthree\n"},
+		{"end", 14, "four", "one\ntwo\nthree\nfour"},
+		{"piece boundary", 8, "2.5\n", "one\ntwo\n2.5\nthree\n"},
+		{"inside original piece", 1, "-", "o-ne\ntwo\nthree\n"},
+		{"inside add piece", 5, "-", "one\nt-wo\nthree\n"},
+		{"after add piece", 8, "x", "one\ntwo\nxthree\n"},
+		{"newline", 2, "\n", "on\ne\ntwo\nthree\n"},
+		{"empty", 3, "", "one\ntwo\nthree\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := splitTable()
+			pt.Insert(tt.offset, tt.text)
+			if got := pt.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			if got, want := pt.Len(), len(tt.want); got != want {
+				t.Errorf("Len() = %d, want %d", got, want)
+			}
+			if got, want := pt.LineCount(), strings.Count(tt.want, "\n")+1; got != want {
+				t.Errorf("LineCount() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestPieceTableInsertSequential(t *testing.T) {
+	pt := newPieceTable([]byte("ab"))
+	for i, r := range "xyz" {
+		pt.Insert(1+i, string(r))
+	}
+	if got, want := pt.String(), "axyzb"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := len(pt.pieces); got != 3 {
+		t.Errorf("got %d pieces, want typing to extend a single piece", got)
+	}
+}
+
+func TestPieceTableDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+		length int
+		want   string
+	}{
+		{"start", 0, 4, "two\nthree\n"},
+		{"end", 13, 1, "one\ntwo\nthree"},
+		{"whole piece", 4, 4, "one\nthree\n"},
+		{"across boundary", 2, 4, "ono\nthree\n"},
+		{"across every piece", 3, 9, "onee\n"},
+		{"inside piece", 5, 1, "one\nto\nthree\n"},
+		{"newline", 3, 1, "onetwo\nthree\n"},
+		{"everything", 0, 14, ""},
+		{"nothing", 3, 0, "one\ntwo\nthree\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := splitTable()
+			pt.Delete(tt.offset, tt.length)
+			if got := pt.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			if got, want := pt.LineCount(), strings.Count(tt.want, "\n")+1; got != want {
+				t.Errorf("LineCount() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestPieceTableLineStart(t *testing.T) {
+	pt := splitTable()
+	pt.Insert(10, "\n")
+	// one\ntwo\nth\nree\n
+	tests := []struct {
+		line int
+		want int
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 4},
+		{2, 8},
+		{3, 11},
+		{4, 15},
+		{5, 15},
+	}
+	for _, tt := range tests {
+		if got := pt.LineStart(tt.line); got != tt.want {
+			t.Errorf("LineStart(%d) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+	if got, want := pt.LineEnd(2), 10; got != want {
+		t.Errorf("LineEnd(2) = %d, want %d", got, want)
+	}
+}
+
+func TestPieceTablePosition(t *testing.T) {
+	pt := splitTable()
+	pt.Insert(10, "\n")
+	// one\ntwo\nth\nree\n
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{-1, 0, 0},
+		{0, 0, 0},
+		{3, 0, 3},
+		{4, 1, 0},
+		{7, 1, 3},
+		{8, 2, 0},
+		{10, 2, 2},
+		{11, 3, 0},
+		{14, 3, 3},
+		{15, 4, 0},
+		{99, 4, 0},
+	}
+	for _, tt := range tests {
+		line, column := pt.Position(tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("Position(%d) = %d, %d, want %d, %d", tt.offset, line, column, tt.line, tt.column)
+		}
+	}
+}
+
+func TestPieceTableLines(t *testing.T) {
+	pt := splitTable()
+	pt.Insert(10, "\n")
+	got := pt.Lines(1, 3)
+	want := []string{"two", "th", "ree"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Lines(1, 3) = %q, want %q", got, want)
+	}
+	if got := pt.Lines(4, 2); len(got) != 1 || got[0] != "" {
+		t.Errorf("Lines(4, 2) = %q, want the empty last line", got)
+	}
+}
+
+// largeText returns n lines of text
+func largeText(n int) []byte {
+	var sb strings.Builder
+	for i := range n {
+		fmt.Fprintf(&sb, "line %d of a large file with some text on it\n", i)
+	}
+	return []byte(sb.String())
+}
+
+func BenchmarkInsert(b *testing.B) {
+	pt := newPieceTable(largeText(1_000_000))
+	// Insert all over the file so the piece list keeps growing
+	step := pt.Len() / 1000
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pt.Insert((i*step)%pt.Len(), "x")
+	}
+}
+
+func BenchmarkDelete(b *testing.B) {
+	pt := newPieceTable(largeText(1_000_000))
+	step := pt.Len() / 1000
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pt.Delete((i*step)%(pt.Len()-1), 1)
+	}
+}
+
+func BenchmarkInsertLongLine(b *testing.B) {
+	pt := newPieceTable([]byte(strings.Repeat("x", 10_000_000)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pt.Insert(pt.Len()/2, "y")
+		if i%2 == 1 {
+			pt.Delete(pt.Len()/2, 1)
+		}
+	}
+}
+
+func BenchmarkLinesInRange(b *testing.B) {
+	mb := NewMemoryBuffer(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mb.text = newPieceTable(largeText(1_000_000))
+	// Edits split the file into pieces, as they would while editing it
+	for i := range 100 {
+		mb.text.Insert(i*mb.text.Len()/100, "edit\n")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := int64(i*9973%1_000_000 + 1)
+		mb.LinesInRange(LineRange{start, start + 50})
+	}
+}
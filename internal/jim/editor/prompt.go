@@ -0,0 +1,32 @@
+package editor
+
+import (
+	"unicode"
+
+	"github.com/jstotz/jim/internal/jim/keys"
+)
+
+// prompt asks the user to pick one of several choices by pressing its key.
+// While a prompt is shown every keypress goes to it.
+type prompt struct {
+	message string
+	choices map[rune]func() error
+}
+
+func (e *Editor) showPrompt(message string, choices map[rune]func() error) {
+	e.prompt = &prompt{message: message, choices: choices}
+}
+
+// handlePromptKeypress runs the choice for the given key, ignoring keys that
+// aren't a choice. Errors are shown to the user instead of being returned.
+func (e *Editor) handlePromptKeypress(k keys.Key) {
+	choice, ok := e.prompt.choices[unicode.ToLower(k.Rune)]
+	if !ok || !k.IsText() {
+		return
+	}
+	e.prompt = nil
+	if err := choice(); err != nil {
+		e.Logger.Error("prompt choice error", "err", err)
+		e.message = err.Error()
+	}
+}
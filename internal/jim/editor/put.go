@@ -0,0 +1,150 @@
+package editor
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/registers"
+)
+
+// takeRegister returns the register selected for the current command with
+// "x and resets the selection to the unnamed register
+func (e *Editor) takeRegister() rune {
+	name := e.registerName
+	e.registerName = registers.Unnamed
+	return name
+}
+
+// storeRegister saves the text an operator yanked or deleted in the named
+// register. Errors such as writing a read-only register are shown to the user
+// without stopping the operator.
+func (e *Editor) storeRegister(name rune, op command.Operator, r registers.Register) {
+	var err error
+	if op == command.OperatorYank {
+		err = e.registers.Yank(name, r)
+	} else {
+		err = e.registers.Delete(name, r)
+	}
+	if err != nil {
+		e.message = err.Error()
+	}
+}
+
+// put inserts the contents of the selected register count times
+func (e *Editor) put(before bool, count int) error {
+	r, err := e.registers.Get(e.takeRegister())
+	if err != nil {
+		e.message = err.Error()
+		return nil
+	}
+	if r.Text == "" {
+		e.message = "E353: Nothing in register"
+		return nil
+	}
+	w := e.FocusedWindow()
+	count = max(count, 1)
+	switch r.Type {
+	case registers.Linewise:
+		return putLines(w, strings.Repeat(r.Text, count), before)
+	case registers.Blockwise:
+		return putBlock(w, strings.Split(r.Text, "\n"), before, count)
+	}
+	return putChars(w, strings.Repeat(r.Text, count), before)
+}
+
+// putColumn returns the column text is put at: the cursor, or after the
+// character under it
+func putColumn(w *Window, p Point, before bool) int {
+	line, _ := bufferLine(w.buffer, p.row)
+	if before || p.column > len(line) {
+		return p.column
+	}
+	_, size := utf8.DecodeRuneInString(line[p.column-1:])
+	return p.column + size
+}
+
+// putChars puts text into the line, leaving the cursor on the last character
+// put, or on the first if it spans lines
+func putChars(w *Window, text string, before bool) error {
+	p := w.CurrentPosition()
+	p.column = putColumn(w, p, before)
+	start := w.buffer.Offset(p)
+	if err := w.InsertText(p, text); err != nil {
+		return err
+	}
+	if strings.Contains(text, "\n") {
+		w.SetPosition(p)
+		return nil
+	}
+	_, size := utf8.DecodeLastRuneInString(text)
+	w.SetPosition(w.buffer.PointAt(start + len(text) - size))
+	return nil
+}
+
+// putLines puts lines below the current line, or above it, leaving the
+// cursor on the first line put
+func putLines(w *Window, text string, before bool) error {
+	row := w.CurrentPosition().row
+	first := row
+	switch {
+	case before:
+		if err := w.InsertText(Point{row: row, column: 1}, text); err != nil {
+			return err
+		}
+	case isLastLine(w.buffer, row):
+		// The last line has no newline to put the lines after
+		text = "\n" + strings.TrimSuffix(text, "\n")
+		if err := w.InsertText(Point{row: row, column: w.lineLength(row) + 1}, text); err != nil {
+			return err
+		}
+		first++
+	default:
+		if err := w.InsertText(Point{row: row + 1, column: 1}, text); err != nil {
+			return err
+		}
+		first++
+	}
+	line, _ := bufferLine(w.buffer, first)
+	w.SetPosition(Point{row: first, column: firstNonBlank(line)})
+	return nil
+}
+
+// putBlock puts a block of text into consecutive lines at the same column,
+// adding lines at the end of the buffer and padding short lines as needed
+func putBlock(w *Window, lines []string, before bool, count int) error {
+	p := w.CurrentPosition()
+	column := putColumn(w, p, before)
+	width := 0
+	for _, l := range lines {
+		width = max(width, len(l))
+	}
+
+	history := w.buffer.UndoTree()
+	history.BeginGroup()
+	defer history.EndGroup()
+	for i, l := range lines {
+		row := p.row + i
+		if _, ok := bufferLine(w.buffer, row); !ok {
+			last := row - 1
+			if err := w.InsertText(Point{row: last, column: w.lineLength(last) + 1}, "\n"); err != nil {
+				return err
+			}
+		}
+		content, _ := bufferLine(w.buffer, row)
+		text := strings.Repeat(l, count)
+		at := column
+		if len(content) < column-1 {
+			text = strings.Repeat(" ", column-1-len(content)) + text
+			at = len(content) + 1
+		} else if len(content) >= column {
+			// Keep the text after the block aligned
+			text += strings.Repeat(" ", (width-len(l))*count)
+		}
+		if err := w.InsertText(Point{row: row, column: at}, text); err != nil {
+			return err
+		}
+	}
+	w.SetPosition(Point{row: p.row, column: column})
+	return nil
+}
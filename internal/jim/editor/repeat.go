@@ -0,0 +1,117 @@
+package editor
+
+import (
+	"slices"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/modes"
+)
+
+// changeRecorder captures the commands that make up a change in normal mode,
+// from the command starting it to the return to normal mode, so that . can
+// run them again
+type changeRecorder struct {
+	// depth is how deeply runCommand calls are nested. Only the commands run
+	// directly for keypresses are recorded.
+	depth     int
+	recording []command.Command
+	last      []command.Command
+}
+
+// startsChange reports whether a command run in normal mode starts a change
+func startsChange(cmd command.Command) bool {
+	if r, ok := cmd.(command.Repeat); ok {
+		cmd = r.Command
+	}
+	switch cmd := cmd.(type) {
+	case command.BeginOperator:
+		return cmd.Operator != command.OperatorYank
+	case command.ApplyOperator:
+		return cmd.Operator != command.OperatorYank
+	case command.Put:
+		return true
+	case command.ActivateMode:
+		return cmd.Mode == modes.ModeInsert
+	}
+	return false
+}
+
+// recordChange adds a command that was just run in the given mode to the
+// change being recorded. The change is complete once the editor is back in
+// normal mode.
+func (e *Editor) recordChange(mode modes.Mode, cmd command.Command) {
+	c := &e.changes
+	if _, ok := cmd.(command.Noop); ok {
+		// Keys that are part of a longer binding
+		return
+	}
+	switch mode {
+	case modes.ModeNormal:
+		if _, ok := cmd.(command.SelectRegister); ok {
+			// A register selected for the change is used again when repeating it
+			c.recording = []command.Command{cmd}
+			return
+		}
+		if !startsChange(cmd) {
+			c.recording = nil
+			return
+		}
+		c.recording = append(c.recording, cmd)
+	case modes.ModeOperatorPending, modes.ModeInsert, modes.ModeCommand:
+		if c.recording == nil {
+			return
+		}
+		c.recording = append(c.recording, cmd)
+	default:
+		c.recording = nil
+		return
+	}
+
+	switch e.mode {
+	case modes.ModeNormal:
+		c.last, c.recording = c.recording, nil
+	case modes.ModeOperatorPending, modes.ModeInsert, modes.ModeCommand:
+	default:
+		c.recording = nil
+	}
+}
+
+// repeatChange runs the last change again. A count replaces the count the
+// change was made with, except for changes made by entering insert mode,
+// where the text typed is inserted count times.
+func (e *Editor) repeatChange(count int) error {
+	cmds := slices.Clone(e.changes.last)
+	if len(cmds) == 0 {
+		return nil
+	}
+	if count > 0 {
+		i := 0
+		if _, ok := cmds[0].(command.SelectRegister); ok {
+			i++
+		}
+		start := withoutCount(cmds[i])
+		if _, ok := start.(command.ActivateMode); ok {
+			typed := cmds[i+1 : len(cmds)-1]
+			repeated := slices.Clone(cmds[:i+1])
+			for range count {
+				repeated = append(repeated, typed...)
+			}
+			cmds = append(repeated, cmds[len(cmds)-1])
+		} else {
+			cmds[i] = command.Repeat{Count: count, Command: start}
+			if _, ok := start.(command.BeginOperator); ok && len(cmds) > i+1 {
+				// The count typed before the motion is replaced too
+				cmds[i+1] = withoutCount(cmds[i+1])
+			}
+		}
+	}
+	return e.runCommand(command.Sequence{Commands: cmds})
+}
+
+// withoutCount returns a command without the count typed before it
+func withoutCount(cmd command.Command) command.Command {
+	if r, ok := cmd.(command.Repeat); ok {
+		return r.Command
+	}
+	return cmd
+}
@@ -0,0 +1,87 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces the contents of the file at path with what write
+// writes, without ever leaving a partially written file behind. The content
+// is written to a temporary file in the same directory, synced to disk and
+// renamed over the target, so a failure at any point leaves the original
+// file intact. The mode and ownership of an existing file are preserved, and
+// if backup is set the previous contents are kept at path~.
+func writeFileAtomic(path string, write func(w io.Writer) error, backup bool) (err error) {
+	// Replace the target of a symlink rather than the link itself
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	mode := fs.FileMode(0666)
+	info, statErr := os.Stat(path)
+	exists := statErr == nil
+	if exists {
+		mode = info.Mode().Perm()
+	} else if !errors.Is(statErr, fs.ErrNotExist) {
+		return fmt.Errorf("stat %s: %w", path, statErr)
+	}
+
+	dir, name := filepath.Split(path)
+	tmp, err := os.CreateTemp(dir, "."+name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return fmt.Errorf("write temp file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("chmod temp file %s: %w", tmp.Name(), err)
+	}
+	if exists {
+		if err := chownLike(tmp, info); err != nil {
+			return fmt.Errorf("chown temp file %s: %w", tmp.Name(), err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("sync temp file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file %s: %w", tmp.Name(), err)
+	}
+
+	if backup && exists {
+		if err := copyFile(path, path+"~", mode); err != nil {
+			return fmt.Errorf("backup %s: %w", path, err)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename %s to %s: %w", tmp.Name(), path, err)
+	}
+
+	// Make the rename itself durable
+	if d, err := os.Open(filepath.Clean(dir + string(filepath.Separator))); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+func copyFile(src, dst string, mode fs.FileMode) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, content, mode)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package editor
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chownLike is a noop on platforms without unix file ownership
+func chownLike(f *os.File, info fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package editor
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// chownLike gives f the same owner and group as the file described by info.
+// Only the owner of a file or root can change it, so being denied permission
+// to give the file away isn't treated as an error.
+func chownLike(f *os.File, info fs.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := f.Chown(int(stat.Uid), int(stat.Gid))
+	if errors.Is(err, fs.ErrPermission) {
+		return nil
+	}
+	return err
+}
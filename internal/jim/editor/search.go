@@ -0,0 +1,342 @@
+package editor
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/modes"
+	"github.com/jstotz/jim/internal/jim/regex"
+)
+
+const (
+	matchHighlightStart = "\033[30;43m"
+	matchHighlightEnd   = "\033[39;49m"
+)
+
+// searchState is the last search, which n and N repeat
+type searchState struct {
+	pattern  string
+	backward bool
+	// highlight is whether the matches of the pattern are highlighted
+	highlight bool
+	// origin is where the cursor was when the search prompt opened, while it
+	// is open
+	origin *Point
+	// operator is the operator the search was typed for in operator-pending
+	// mode, if any
+	operator *command.BeginOperator
+}
+
+// startSearch opens the search prompt
+func (e *Editor) startSearch(backward bool) error {
+	if err := e.activateMode(modes.ModeCommand); err != nil {
+		return err
+	}
+	e.commandPrompt = '/'
+	if backward {
+		e.commandPrompt = '?'
+	}
+	p := e.window.CurrentPosition()
+	e.search.origin = &p
+	return nil
+}
+
+// startOperatorSearch opens the search prompt for the pending operator to act
+// on the text up to the match
+func (e *Editor) startOperatorSearch(backward bool) error {
+	op := e.operator
+	if err := e.startSearch(backward); err != nil {
+		return err
+	}
+	e.search.operator = &op
+	return nil
+}
+
+// searching reports whether the search prompt is open
+func (e *Editor) searching() bool {
+	return e.mode == modes.ModeCommand && e.search.origin != nil
+}
+
+// updateIncrementalSearch moves the cursor to the first match of the pattern
+// typed so far and highlights all its matches. Patterns that don't compile
+// yet, like a group that hasn't been closed, match nothing.
+func (e *Editor) updateIncrementalSearch() {
+	w := e.window
+	origin := *e.search.origin
+	w.SetPosition(origin)
+	w.highlight = nil
+	pattern := searchPattern(bufferText(e.commandWindow.buffer), e.commandPrompt)
+	if pattern == "" {
+		return
+	}
+	re, err := e.compilePattern(pattern)
+	if err != nil {
+		return
+	}
+	w.highlight = re
+	if target, ok := searchTarget(w.buffer, origin, re, e.commandPrompt == '?', 1); ok {
+		w.SetPosition(target)
+	}
+}
+
+// cancelSearch closes the search prompt, returning the cursor to where it was
+func (e *Editor) cancelSearch() {
+	e.window.SetPosition(*e.search.origin)
+	e.search.origin = nil
+	e.search.operator = nil
+	e.updateHighlight()
+}
+
+// searchPattern returns the pattern typed in the search prompt. An unescaped
+// prompt character ends the pattern, and the search offset that can follow
+// it is ignored.
+func searchPattern(input string, prompt rune) string {
+	escaped := false
+	for i, r := range input {
+		if r == prompt && !escaped {
+			return input[:i]
+		}
+		escaped = !escaped && r == '\\'
+	}
+	return input
+}
+
+// evalSearch searches for the pattern typed in the search prompt. An empty
+// pattern searches for the last pattern again.
+func (e *Editor) evalSearch(input string) error {
+	pattern := searchPattern(input, e.commandPrompt)
+	backward := e.commandPrompt == '?'
+	op := e.search.operator
+	e.cancelSearch()
+	e.commandWindow.Clear()
+	if err := e.activateMode(modes.ModeNormal); err != nil {
+		return err
+	}
+	if pattern == "" {
+		pattern = e.search.pattern
+	}
+	if _, err := e.compilePattern(pattern); err != nil {
+		e.message = err.Error()
+		return nil
+	}
+	e.search.pattern, e.search.backward = pattern, backward
+	e.registers.SetReadOnly('/', pattern)
+	if op != nil {
+		return e.applyOperator(command.ApplyOperator{Operator: op.Operator, Target: command.SearchNext{}, Count: op.Count})
+	}
+	e.moveCursor(command.SearchNext{}, 0)
+	return nil
+}
+
+// compilePattern compiles a search pattern using the case options
+func (e *Editor) compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regex.Compile(pattern, e.config.IgnoreCase, e.config.SmartCase)
+}
+
+// casePattern prefixes a pattern with \c or \C to match case the way the
+// ignorecase and smartcase options decide. Smartcase doesn't apply to the
+// patterns of * and #.
+func (e *Editor) casePattern(pattern string, smart bool) string {
+	if e.config.IgnoreCase && !(smart && e.config.SmartCase && regex.HasUpper(pattern)) {
+		return `\c` + pattern
+	}
+	return `\C` + pattern
+}
+
+// updateHighlight highlights the matches of the last search in every window
+// unless highlighting was turned off
+func (e *Editor) updateHighlight() {
+	var highlight *regexp.Regexp
+	if e.search.highlight && e.search.pattern != "" {
+		if re, err := e.compilePattern(e.search.pattern); err == nil {
+			highlight = re
+		}
+	}
+	for _, w := range e.windowLayout().windows() {
+		w.highlight = highlight
+	}
+}
+
+// resolveSearch turns a motion that searches for the last pattern or the word
+// under the cursor into a Search, and returns where it searches from. It
+// returns false and shows why if there is nothing to search for.
+func (e *Editor) resolveSearch(b Buffer, p Point, m command.Motion) (command.Motion, Point, bool) {
+	switch m := m.(type) {
+	case command.SearchNext:
+		if e.search.pattern == "" {
+			e.message = "E35: No previous regular expression"
+			return nil, p, false
+		}
+		e.search.highlight = true
+		e.updateHighlight()
+		return command.Search{Pattern: e.casePattern(e.search.pattern, true), Backward: e.search.backward != m.Reverse}, p, true
+	case command.SearchWord:
+		word, start, ok := keywordAt(b, p)
+		if !ok {
+			e.message = "E348: No string under cursor"
+			return nil, p, false
+		}
+		pattern := word
+		if isASCII(word) {
+			pattern = `\<` + word + `\>`
+		}
+		e.search.pattern, e.search.backward, e.search.highlight = pattern, m.Backward, true
+		e.registers.SetReadOnly('/', pattern)
+		e.updateHighlight()
+		// Searching backward from the start of the word skips the word itself
+		if m.Backward {
+			p = start
+		}
+		return command.Search{Pattern: e.casePattern(pattern, false), Backward: m.Backward}, p, true
+	}
+	return m, p, true
+}
+
+// reportSearch shows that a search wrapped around the end of the buffer or
+// failed to find a match
+func (e *Editor) reportSearch(b Buffer, m command.Motion, from, to Point, ok bool) {
+	s, isSearch := m.(command.Search)
+	switch {
+	case !isSearch:
+	case !ok:
+		e.message = "E486: Pattern not found: " + e.search.pattern
+	case !s.Backward && b.Offset(to) <= b.Offset(from):
+		e.message = "search hit BOTTOM, continuing at TOP"
+	case s.Backward && b.Offset(to) >= b.Offset(from):
+		e.message = "search hit TOP, continuing at BOTTOM"
+	}
+}
+
+// searchTarget returns the start of the count-th match of re after p, or
+// before it if backward is set, wrapping around the ends of the buffer
+func searchTarget(b Buffer, p Point, re *regexp.Regexp, backward bool, count int) (Point, bool) {
+	offset := b.Offset(p)
+	for range max(count, 1) {
+		var ok bool
+		if offset, ok = nextMatch(b, offset, re, backward); !ok {
+			return p, false
+		}
+	}
+	return b.PointAt(offset), true
+}
+
+// nextMatch returns the offset of the first match of re that starts after
+// offset, or the last one before it if backward is set. Lines are searched
+// one at a time outward from offset until there is a match, ending with the
+// line of offset again for matches on its other side.
+func nextMatch(b Buffer, offset int, re *regexp.Regexp, backward bool) (int, bool) {
+	lineCount := b.LineCount()
+	row := b.PointAt(offset).row
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := 0; i <= lineCount; i++ {
+		start, matches := lineMatches(b, ((row-1+i*step)%lineCount+lineCount)%lineCount+1, re)
+		if backward {
+			for j := len(matches) - 1; j >= 0; j-- {
+				if i > 0 || start+matches[j] < offset {
+					return start + matches[j], true
+				}
+			}
+			continue
+		}
+		for _, m := range matches {
+			if i > 0 || start+m > offset {
+				return start + m, true
+			}
+		}
+	}
+	return offset, false
+}
+
+// lineMatches returns the offset of a line and where the matches of re that
+// start on it start, relative to the line. The line is matched along with
+// the next one so that matches can continue onto it, though not past it.
+func lineMatches(b Buffer, row int, re *regexp.Regexp) (int, []int) {
+	start := b.Offset(Point{row: row, column: 1})
+	next := b.Offset(Point{row: row + 1, column: 1})
+	text := b.Slice(start, b.Offset(Point{row: row + 2, column: 1}))
+	last := row == b.LineCount()
+	var starts []int
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		// Matches at the start of the next line belong to it
+		if start+m[0] < next || last {
+			starts = append(starts, m[0])
+		}
+	}
+	return start, starts
+}
+
+// bufferText returns the text of a buffer as offsets count it, without the
+// line ending conversion of String
+func bufferText(b Buffer) string {
+	return b.Slice(0, b.Offset(Point{row: b.LineCount() + 1, column: 1}))
+}
+
+// keywordAt returns the keyword under the cursor, or the first one after it
+// on the line, and where it starts
+func keywordAt(b Buffer, p Point) (string, Point, bool) {
+	line, _ := bufferLine(b, p.row)
+	start := min(p.column-1, len(line))
+	for start < len(line) {
+		r, size := utf8.DecodeRuneInString(line[start:])
+		if charClass(r) == 2 {
+			break
+		}
+		start += size
+	}
+	if start == len(line) {
+		return "", p, false
+	}
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:start])
+		if charClass(r) != 2 {
+			break
+		}
+		start -= size
+	}
+	end := start
+	for end < len(line) {
+		r, size := utf8.DecodeRuneInString(line[end:])
+		if charClass(r) != 2 {
+			break
+		}
+		end += size
+	}
+	return line[start:end], Point{row: p.row, column: start + 1}, true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// renderMatches renders a line with the matches of the window's highlight
+// pattern highlighted
+func (w *Window) renderMatches(line string) string {
+	matches := w.highlight.FindAllStringIndex(line, -1)
+	if len(matches) == 0 {
+		return line
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m[0] == m[1] {
+			continue
+		}
+		sb.WriteString(line[last:m[0]])
+		sb.WriteString(matchHighlightStart)
+		sb.WriteString(line[m[0]:m[1]])
+		sb.WriteString(matchHighlightEnd)
+		last = m[1]
+	}
+	sb.WriteString(line[last:])
+	return sb.String()
+}
@@ -0,0 +1,43 @@
+package editor
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSearchTarget(t *testing.T) {
+	const text = "one two\nthree two\n\nfour one\n"
+	tests := []struct {
+		name     string
+		from     Point
+		pattern  string
+		backward bool
+		count    int
+		want     Point
+		ok       bool
+	}{
+		{"same line", Point{1, 1}, "two", false, 1, Point{1, 5}, true},
+		{"skips the cursor", Point{1, 5}, "two", false, 1, Point{2, 7}, true},
+		{"count", Point{1, 1}, "two", false, 2, Point{2, 7}, true},
+		{"wraps to top", Point{3, 1}, "two", false, 1, Point{1, 5}, true},
+		{"wraps to the cursor line", Point{1, 6}, "one", false, 2, Point{1, 1}, true},
+		{"backward", Point{2, 7}, "two", true, 1, Point{1, 5}, true},
+		{"backward same line", Point{4, 6}, "f", true, 1, Point{4, 1}, true},
+		{"backward wraps to bottom", Point{1, 1}, "one", true, 1, Point{4, 6}, true},
+		{"anchored", Point{1, 1}, "^t", false, 1, Point{2, 1}, true},
+		{"empty line", Point{1, 1}, "^$", false, 1, Point{3, 1}, true},
+		{"across a line break", Point{1, 1}, `two\nthree`, false, 1, Point{1, 5}, true},
+		{"line break at the end", Point{2, 1}, `two\n\n`, false, 1, Point{2, 7}, true},
+		{"not found", Point{2, 3}, "five", false, 1, Point{2, 3}, false},
+	}
+	b := newTestBuffer(t, text)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := regexp.MustCompile("(?m)" + tt.pattern)
+			got, ok := searchTarget(b, tt.from, re, tt.backward, tt.count)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("searchTarget(%v, %q) = %v, %v, want %v, %v", tt.from, tt.pattern, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
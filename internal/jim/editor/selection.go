@@ -0,0 +1,141 @@
+package editor
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	highlightStart = "\033[7m"
+	highlightEnd   = "\033[27m"
+)
+
+// selectionKind is how the text between a window's selection anchor and its
+// cursor is selected
+type selectionKind int
+
+const (
+	selectionCharacters selectionKind = iota
+	selectionLines
+	selectionBlock
+)
+
+// selection is the text selected in a window in visual mode. The anchor is
+// the buffer position where the selection started; the cursor is the other
+// end.
+type selection struct {
+	anchor Point
+	kind   selectionKind
+}
+
+// StartSelection starts selecting text of the given kind from the cursor, or
+// changes the kind of the current selection
+func (w *Window) StartSelection(kind selectionKind) {
+	if w.selection != nil {
+		w.selection.kind = kind
+		return
+	}
+	w.selection = &selection{anchor: w.CurrentPosition(), kind: kind}
+}
+
+func (w *Window) ClearSelection() {
+	w.selection = nil
+}
+
+// SwapSelectionEnds moves the cursor to the anchor of the selection and the
+// anchor to where the cursor was
+func (w *Window) SwapSelectionEnds() {
+	if w.selection == nil {
+		return
+	}
+	p := w.CurrentPosition()
+	w.SetPosition(w.selection.anchor)
+	w.selection.anchor = p
+}
+
+// selectionRegion returns the region covered by the selection. Character
+// selections include the character under the cursor, and the newline ending
+// the line if the cursor is past its end.
+func (w *Window) selectionRegion() region {
+	p := w.CurrentPosition()
+	start, end := w.selection.anchor, p
+	if end.row < start.row || (end.row == start.row && end.column < start.column) {
+		start, end = end, start
+	}
+	switch w.selection.kind {
+	case selectionLines:
+		return region{start: start, end: end, linewise: true}
+	case selectionBlock:
+		left, right := min(start.column, end.column), max(start.column, end.column)
+		return region{start: Point{row: start.row, column: left}, end: Point{row: end.row, column: right}, block: true}
+	}
+	line, _ := bufferLine(w.buffer, end.row)
+	if end.column > len(line) {
+		if _, ok := bufferLine(w.buffer, end.row+1); ok {
+			return region{start: start, end: Point{row: end.row + 1, column: 1}}
+		}
+		return region{start: start, end: Point{row: end.row, column: len(line) + 1}}
+	}
+	_, size := utf8.DecodeRuneInString(line[end.column-1:])
+	end.column += size
+	return region{start: start, end: end}
+}
+
+// blockColumns returns the byte range of a line covered by a block region,
+// which includes the character at its right column
+func blockColumns(line string, r region) (from, to int) {
+	from = min(r.start.column-1, len(line))
+	for from > 0 && from < len(line) && !utf8.RuneStart(line[from]) {
+		from--
+	}
+	to = min(r.end.column-1, len(line))
+	if to < len(line) {
+		_, size := utf8.DecodeRuneInString(line[to:])
+		to += size
+	}
+	return from, max(from, to)
+}
+
+// highlightedColumns returns the byte range of the given line covered by the
+// selection. eol is set if the newline ending the line is selected too.
+func (w *Window) highlightedColumns(row int, line string) (from, to int, eol bool) {
+	r := w.selectionRegion()
+	if row < r.start.row || row > r.end.row {
+		return 0, 0, false
+	}
+	switch {
+	case r.linewise:
+		return 0, len(line), true
+	case r.block:
+		from, to = blockColumns(line, r)
+		return from, to, false
+	}
+	from, to = 0, len(line)
+	if row == r.start.row {
+		from = min(r.start.column-1, len(line))
+	}
+	if row == r.end.row {
+		to = min(r.end.column-1, len(line))
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// renderSelected renders a line with the selected part highlighted
+func (w *Window) renderSelected(row int, line string) string {
+	from, to, eol := w.highlightedColumns(row, line)
+	if from == to && !eol {
+		return line
+	}
+	var sb strings.Builder
+	sb.WriteString(line[:from])
+	sb.WriteString(highlightStart)
+	sb.WriteString(line[from:to])
+	if eol {
+		// Show the selected newline as a highlighted space
+		sb.WriteString(" ")
+	}
+	sb.WriteString(highlightEnd)
+	sb.WriteString(line[to:])
+	return sb.String()
+}
@@ -0,0 +1,309 @@
+package editor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jstotz/jim/internal/jim/command"
+)
+
+// reportThreshold is how many substitutions it takes for :s to report how
+// many it made
+const reportThreshold = 2
+
+// substitution is a :s in progress. With the confirm flag it stops at each
+// match to ask the user what to do with it.
+type substitution struct {
+	cmd command.Substitute
+	re  *regexp.Regexp
+	w   *Window
+	// remaining is how many lines of the range haven't been searched yet
+	remaining int
+	// start is the offset of the line being searched and text its text as
+	// it was before any of it was replaced, including its newline. found
+	// holds the matches in text that are left, and shift how far the
+	// replacements so far moved the rest of the line.
+	start int
+	text  string
+	found [][]int
+	shift int
+	// joined is set when a match ended with the newline of the previous
+	// line, so an empty match at the start of this one would touch it
+	joined  bool
+	matches int
+	lines   int
+	// lastRow is the row of the last match
+	lastRow int
+}
+
+func (e *Editor) substitute(cmd command.Substitute) error {
+	if cmd.Repeat {
+		if e.lastSubstitute == nil {
+			e.message = "E35: No previous regular expression"
+			return nil
+		}
+		cmd.Pattern, cmd.Replacement = e.lastSubstitute.Pattern, e.lastSubstitute.Replacement
+		cmd.Repeat = false
+	}
+	pattern := cmd.Pattern
+	if pattern == "" {
+		pattern = e.search.pattern
+	}
+	if pattern == "" {
+		e.message = "E35: No previous regular expression"
+		return nil
+	}
+	caseFlag := ""
+	if cmd.IgnoreCase {
+		caseFlag = `\c`
+	} else if cmd.MatchCase {
+		caseFlag = `\C`
+	}
+	re, err := e.compilePattern(caseFlag + pattern)
+	if err != nil {
+		e.message = err.Error()
+		return nil
+	}
+	e.search.pattern, e.search.highlight = pattern, true
+	e.registers.SetReadOnly('/', pattern)
+	e.lastSubstitute = &cmd
+
+	start := e.window.buffer.Offset(Point{row: cmd.FirstLine, column: 1})
+	s := &substitution{cmd: cmd, re: re, w: e.window, remaining: cmd.LastLine - cmd.FirstLine + 1, start: start}
+	if !cmd.CountOnly {
+		s.w.buffer.UndoTree().BeginGroup()
+	}
+	if cmd.Confirm && !cmd.CountOnly {
+		return e.confirmSubstitution(s)
+	}
+	return e.runSubstitution(s)
+}
+
+// runSubstitution makes the remaining substitutions without asking
+func (e *Editor) runSubstitution(s *substitution) error {
+	for {
+		m, ok := s.next()
+		if !ok {
+			break
+		}
+		if s.cmd.CountOnly {
+			s.skip(m)
+			continue
+		}
+		if err := s.replace(m); err != nil {
+			s.w.buffer.UndoTree().EndGroup()
+			return err
+		}
+	}
+	e.finishSubstitution(s)
+	return nil
+}
+
+// confirmSubstitution moves to the next match and asks whether to replace it
+func (e *Editor) confirmSubstitution(s *substitution) error {
+	m, ok := s.next()
+	if !ok {
+		e.finishSubstitution(s)
+		return nil
+	}
+	s.w.SetPosition(s.w.buffer.PointAt(s.start + s.shift + m[0]))
+	s.w.highlight = s.re
+	replacement := expandReplacement(s.cmd.Replacement, s.text, m)
+	e.showPrompt(fmt.Sprintf("replace with %s (y/n/a/q/l)?", replacement), map[rune]func() error{
+		'y': func() error {
+			if err := s.replace(m); err != nil {
+				s.w.buffer.UndoTree().EndGroup()
+				return err
+			}
+			return e.confirmSubstitution(s)
+		},
+		'n': func() error {
+			s.skip(m)
+			return e.confirmSubstitution(s)
+		},
+		'a': func() error {
+			if err := s.replace(m); err != nil {
+				s.w.buffer.UndoTree().EndGroup()
+				return err
+			}
+			return e.runSubstitution(s)
+		},
+		'l': func() error {
+			err := s.replace(m)
+			e.finishSubstitution(s)
+			return err
+		},
+		'q': func() error {
+			e.finishSubstitution(s)
+			return nil
+		},
+	})
+	return nil
+}
+
+// finishSubstitution ends the undo step of the substitution, moves the cursor
+// to the last line changed and reports what was done
+func (e *Editor) finishSubstitution(s *substitution) {
+	e.updateHighlight()
+	if s.cmd.CountOnly {
+		if s.matches == 0 {
+			e.message = "E486: Pattern not found: " + e.search.pattern
+			return
+		}
+		e.message = fmt.Sprintf("%d %s on %d %s", s.matches, plural(s.matches, "match", "matches"), s.lines, plural(s.lines, "line", "lines"))
+		return
+	}
+	s.w.buffer.UndoTree().EndGroup()
+	if s.matches == 0 {
+		if !s.cmd.Confirm {
+			e.message = "E486: Pattern not found: " + e.search.pattern
+		}
+		return
+	}
+	line, _ := bufferLine(s.w.buffer, s.lastRow)
+	s.w.SetPosition(Point{row: s.lastRow, column: firstNonBlank(line)})
+	if s.matches > reportThreshold {
+		e.message = fmt.Sprintf("%d %s on %d %s", s.matches, plural(s.matches, "substitution", "substitutions"), s.lines, plural(s.lines, "line", "lines"))
+	}
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// next returns the next match in the range, as offsets of the match and its
+// groups in s.text. Each line is matched once before any of it is replaced,
+// so replacements are never matched again, and ^ and \< only match where
+// they did in the original line.
+func (s *substitution) next() ([]int, bool) {
+	for len(s.found) == 0 {
+		if s.remaining == 0 {
+			return nil, false
+		}
+		s.nextLine()
+	}
+	m := s.found[0]
+	s.found = s.found[1:]
+	return m, true
+}
+
+// nextLine moves on to the next line of the range and finds its matches.
+// Without the g flag only the first one is replaced.
+func (s *substitution) nextLine() {
+	b := s.w.buffer
+	s.start += len(s.text) + s.shift
+	s.text = b.Slice(s.start, b.Offset(Point{row: b.PointAt(s.start).row + 1, column: 1}))
+	s.found, s.shift = nil, 0
+	s.remaining--
+	for _, m := range s.re.FindAllStringSubmatchIndex(s.text, -1) {
+		// Matches after the newline belong to the next line
+		if m[0] == len(s.text) && strings.HasSuffix(s.text, "\n") {
+			continue
+		}
+		if m[0] == m[1] && m[0] == 0 && s.joined {
+			continue
+		}
+		s.found = append(s.found, m)
+		if !s.cmd.Global {
+			break
+		}
+	}
+	s.joined = false
+}
+
+// replace replaces a match found by next
+func (s *substitution) replace(m []int) error {
+	offset := s.start + s.shift
+	replacement := expandReplacement(s.cmd.Replacement, s.text, m)
+	if err := replaceText(s.w, offset+m[0], offset+m[1], replacement); err != nil {
+		return err
+	}
+	s.shift += len(replacement) - (m[1] - m[0])
+	s.count()
+	s.joined = strings.HasSuffix(s.text[m[0]:m[1]], "\n")
+	return nil
+}
+
+// skip moves past a match found by next without replacing it
+func (s *substitution) skip(m []int) {
+	if s.cmd.CountOnly {
+		s.count()
+	}
+	s.joined = strings.HasSuffix(s.text[m[0]:m[1]], "\n")
+}
+
+func (s *substitution) count() {
+	row := s.w.buffer.PointAt(s.start).row
+	if s.matches == 0 || s.lastRow != row {
+		s.lines++
+	}
+	s.matches++
+	s.lastRow = row
+}
+
+// expandReplacement returns the text that replaces a match. m holds the
+// offsets of the match and its groups in text. In the replacement & and \0
+// stand for the match, \1 to \9 for its groups, \r and \n for a line break
+// and \t for a tab. \u and \l change the case of the next character, \U and
+// \L of everything up to \E or \e.
+func expandReplacement(replacement, text string, m []int) string {
+	var sb strings.Builder
+	var once, until rune
+	write := func(s string) {
+		for _, r := range s {
+			switch {
+			case once == 'u':
+				r, once = unicode.ToUpper(r), 0
+			case once == 'l':
+				r, once = unicode.ToLower(r), 0
+			case until == 'U':
+				r = unicode.ToUpper(r)
+			case until == 'L':
+				r = unicode.ToLower(r)
+			}
+			sb.WriteRune(r)
+		}
+	}
+	group := func(n int) string {
+		if 2*n+1 < len(m) && m[2*n] >= 0 {
+			return text[m[2*n]:m[2*n+1]]
+		}
+		return ""
+	}
+
+	runes := []rune(replacement)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '&' {
+			write(group(0))
+			continue
+		}
+		if r != '\\' || i+1 == len(runes) {
+			write(string(r))
+			continue
+		}
+		i++
+		switch r = runes[i]; {
+		case r >= '0' && r <= '9':
+			write(group(int(r - '0')))
+		case r == 'u', r == 'l':
+			once = r
+		case r == 'U', r == 'L':
+			until = r
+		case r == 'E', r == 'e':
+			until = 0
+		case r == 'r', r == 'n':
+			write("\n")
+		case r == 't':
+			write("\t")
+		default:
+			write(string(r))
+		}
+	}
+	return sb.String()
+}
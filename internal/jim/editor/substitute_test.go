@@ -0,0 +1,101 @@
+package editor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jstotz/jim/internal/jim/keys"
+)
+
+func TestSubstitute(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		command string
+		want    string
+		message string
+	}{
+		{"first match", "aaa\naa", "%s/a/b/", "baa\nba", ""},
+		{"every match", "aaa\naa", "%s/a/b/g", "bbb\nbb", "5 substitutions on 2 lines"},
+		{"range", "a\na\na", "2,3s/a/b/", "a\nb\nb", ""},
+		{"anchored at the start", "aaab", "s/^a//g", "aab", ""},
+		{"anchored at the end", "baaa", "s/a$//g", "baa", ""},
+		{"word start", "aab", `s/\<a//g`, "ab", ""},
+		{"replacement matches again", "a", "s/a/aa/g", "aa", ""},
+		{"empty matches", "abc", "s/x*/-/g", "-a-b-c-", "4 substitutions on 1 line"},
+		{"groups", "john smith", `s/\(\w\+\) \(\w\+\)/\u\2, \1/`, "Smith, john", ""},
+		{"split lines", "a,b\nc", `%s/,/\r/g`, "a\nb\nc", ""},
+		{"join lines", "a\nb\nc\nd", `1,3s/\n/-/`, "a-b-c-d", "3 substitutions on 1 line"},
+		{"join every line", "a\nb\nc\nd", `%s/\n//g`, "abcd", "3 substitutions on 1 line"},
+		{"count only", "aaa\naa", "%s/a//gn", "aaa\naa", "5 matches on 2 lines"},
+		{"not found", "abc", "s/x/y/", "abc", "E486: Pattern not found: x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEditor(t, tt.text)
+			if err := e.evalCommand(tt.command); err != nil {
+				t.Fatalf("%s: %v", tt.command, err)
+			}
+			if got := bufferText(e.window.buffer); got != tt.want {
+				t.Errorf("%s gave %q, want %q", tt.command, got, tt.want)
+			}
+			if e.message != tt.message {
+				t.Errorf("%s reported %q, want %q", tt.command, e.message, tt.message)
+			}
+		})
+	}
+}
+
+func TestSubstituteConfirm(t *testing.T) {
+	e := newTestEditor(t, "a a\na")
+	if err := e.evalCommand("%s/a/b/gc"); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range "yny" {
+		if e.prompt == nil {
+			t.Fatalf("no prompt before %c", r)
+		}
+		e.handlePromptKeypress(keys.Rune(r))
+	}
+	if got, want := bufferText(e.window.buffer), "b a\nb"; got != want {
+		t.Errorf("buffer = %q, want %q", got, want)
+	}
+	if e.prompt != nil {
+		t.Error("prompt still open after the last match")
+	}
+	// The substitution is a single undo step
+	if _, _, err := e.window.buffer.UndoTree().Undo(e.window.buffer); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bufferText(e.window.buffer), "a a\na"; got != want {
+		t.Errorf("after undo buffer = %q, want %q", got, want)
+	}
+}
+
+// failingBuffer is a buffer that can't be inserted into
+type failingBuffer struct {
+	*MemoryBuffer
+}
+
+func (b failingBuffer) InsertText(p Point, text string) error {
+	return errors.New("insert failed")
+}
+
+func TestSubstituteConfirmErrorEndsUndoGroup(t *testing.T) {
+	for _, r := range "yal" {
+		t.Run(string(r), func(t *testing.T) {
+			e := newTestEditor(t, "a\n")
+			e.window.buffer = failingBuffer{newTestBuffer(t, "a\n")}
+			if err := e.evalCommand("s/a/b/c"); err != nil {
+				t.Fatal(err)
+			}
+			e.handlePromptKeypress(keys.Rune(r))
+			if e.message != "insert failed" {
+				t.Errorf("message = %q, want the insert error", e.message)
+			}
+			if groups := e.window.buffer.UndoTree().groups; groups != 0 {
+				t.Errorf("%d undo groups left open", groups)
+			}
+		})
+	}
+}
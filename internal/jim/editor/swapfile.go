@@ -0,0 +1,173 @@
+package editor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const swapFileVersion = 1
+
+// swapHeader is the first line of a swap file. Hash is the hash of the file
+// contents the journaled edits apply to.
+type swapHeader struct {
+	Version int    `json:"version"`
+	Path    string `json:"path"`
+	PID     int    `json:"pid"`
+	Hash    string `json:"hash"`
+}
+
+// swapEdit is a journaled edit: Delete bytes removed at Offset followed by
+// Insert inserted there
+type swapEdit struct {
+	Offset int    `json:"o"`
+	Delete int    `json:"d,omitempty"`
+	Insert string `json:"i,omitempty"`
+}
+
+func (se swapEdit) apply(b Buffer) error {
+	p := b.PointAt(se.Offset)
+	if err := b.DeleteText(p, se.Delete); err != nil {
+		return err
+	}
+	return b.InsertText(p, se.Insert)
+}
+
+// swapFile is a journal of the unsaved edits made to a file buffer. Edits are
+// buffered in memory and appended to the file when synced, so that they can
+// be replayed on top of the saved file if the editor dies.
+type swapFile struct {
+	path    string
+	header  swapHeader
+	file    *os.File
+	pending []swapEdit
+}
+
+// swapFilePath returns the path of the swap file for the file at path
+func swapFilePath(path string) string {
+	dir, name := filepath.Split(path)
+	return filepath.Join(dir, "."+name+".swp")
+}
+
+func newSwapFile(path string, hash string) *swapFile {
+	return &swapFile{
+		path: swapFilePath(path),
+		header: swapHeader{
+			Version: swapFileVersion,
+			Path:    path,
+			PID:     os.Getpid(),
+			Hash:    hash,
+		},
+	}
+}
+
+func (s *swapFile) record(e swapEdit) {
+	s.pending = append(s.pending, e)
+}
+
+// sync appends the pending edits to the swap file, creating it if needed
+func (s *swapFile) sync() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	if s.file == nil {
+		if err := s.create(); err != nil {
+			return err
+		}
+	}
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	for _, e := range s.pending {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("write swap file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write swap file: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync swap file: %w", err)
+	}
+	s.pending = nil
+	return nil
+}
+
+func (s *swapFile) create() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create swap file: %w", err)
+	}
+	if err := json.NewEncoder(f).Encode(s.header); err != nil {
+		f.Close()
+		return fmt.Errorf("write swap file: %w", err)
+	}
+	s.file = f
+	return nil
+}
+
+// reset discards the journal after the buffer was saved with the given hash
+func (s *swapFile) reset(hash string) error {
+	s.pending = nil
+	s.header.Hash = hash
+	return s.remove()
+}
+
+// remove deletes the swap file
+func (s *swapFile) remove() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	s.file = nil
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove swap file: %w", err)
+	}
+	return nil
+}
+
+// swapFileExists reports whether there is a swap file for the file at path
+func swapFileExists(path string) bool {
+	_, err := os.Stat(swapFilePath(path))
+	return err == nil
+}
+
+// readSwapFile reads the header and journaled edits from the swap file for
+// the file at path. A truncated final edit, left by a crash in the middle of
+// a write, is ignored.
+func readSwapFile(path string) (swapHeader, []swapEdit, error) {
+	var header swapHeader
+	f, err := os.Open(swapFilePath(path))
+	if err != nil {
+		return header, nil, fmt.Errorf("read swap file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<30)
+	if !scanner.Scan() {
+		return header, nil, fmt.Errorf("read swap file: missing header")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return header, nil, fmt.Errorf("read swap file header: %w", err)
+	}
+	if header.Version != swapFileVersion {
+		return header, nil, fmt.Errorf("read swap file: unsupported version %d", header.Version)
+	}
+
+	var edits []swapEdit
+	for scanner.Scan() {
+		var e swapEdit
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			break
+		}
+		edits = append(edits, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return header, edits, fmt.Errorf("read swap file: %w", err)
+	}
+	return header, edits, nil
+}
@@ -0,0 +1,211 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// change is a single reversible edit to a buffer: the text deleted at offset
+// and the text inserted in its place
+type change struct {
+	offset   int
+	deleted  string
+	inserted string
+}
+
+func (c change) apply(b Buffer) error {
+	p := b.PointAt(c.offset)
+	if err := b.DeleteText(p, len(c.deleted)); err != nil {
+		return err
+	}
+	return b.InsertText(p, c.inserted)
+}
+
+func (c change) revert(b Buffer) error {
+	p := b.PointAt(c.offset)
+	if err := b.DeleteText(p, len(c.inserted)); err != nil {
+		return err
+	}
+	return b.InsertText(p, c.deleted)
+}
+
+// undoState is a node in the undo tree. Each state holds the changes that
+// lead to it from its parent.
+type undoState struct {
+	seq      int
+	parent   *undoState
+	children []*undoState
+	// redoChild is the child that redo moves to: the one most recently
+	// created or undone from
+	redoChild *undoState
+	changes   []change
+	// cursor is the cursor position before the changes were made
+	cursor Point
+	time   time.Time
+}
+
+// UndoTree records the history of changes to a buffer. Undoing and then
+// making a new change starts a new branch instead of discarding the undone
+// changes, and every state remains reachable by moving through the history
+// chronologically.
+type UndoTree struct {
+	root    *undoState
+	current *undoState
+	// states holds every state indexed by sequence number
+	states []*undoState
+	// open is the state that new changes are added to, if any
+	open *undoState
+	// groups is how many groups are open. Groups opened inside another are
+	// part of the outer one.
+	groups int
+}
+
+func NewUndoTree() *UndoTree {
+	root := &undoState{}
+	return &UndoTree{
+		root:    root,
+		current: root,
+		states:  []*undoState{root},
+	}
+}
+
+// BeginGroup starts collecting every following change into a single undo
+// step until EndGroup is called. Groups nest, so a group begun while another
+// is open only ends with the outer one.
+func (t *UndoTree) BeginGroup() {
+	if t.groups == 0 {
+		t.open = nil
+	}
+	t.groups++
+}
+
+// EndGroup closes the current group of changes
+func (t *UndoTree) EndGroup() {
+	t.groups = max(t.groups-1, 0)
+	if t.groups == 0 {
+		t.open = nil
+	}
+}
+
+// Record adds a change made to the buffer at the given cursor position
+func (t *UndoTree) Record(c change, cursor Point) {
+	if t.open == nil {
+		state := &undoState{
+			seq:    len(t.states),
+			parent: t.current,
+			cursor: cursor,
+			time:   time.Now(),
+		}
+		t.current.children = append(t.current.children, state)
+		t.current.redoChild = state
+		t.states = append(t.states, state)
+		t.current = state
+		t.open = state
+	}
+	t.open.changes = append(t.open.changes, c)
+	if t.groups == 0 {
+		t.open = nil
+	}
+}
+
+// Undo reverts the current state and returns the cursor position from before
+// it was made. It returns false if there is nothing to undo.
+func (t *UndoTree) Undo(b Buffer) (Point, bool, error) {
+	t.open = nil
+	state := t.current
+	if state == t.root {
+		return Point{}, false, nil
+	}
+	for i := len(state.changes) - 1; i >= 0; i-- {
+		if err := state.changes[i].revert(b); err != nil {
+			return Point{}, false, fmt.Errorf("undo: %w", err)
+		}
+	}
+	state.parent.redoChild = state
+	t.current = state.parent
+	return state.cursor, true, nil
+}
+
+// Redo reapplies the most recently undone child of the current state and
+// returns the position of its first change. It returns false if there is
+// nothing to redo.
+func (t *UndoTree) Redo(b Buffer) (Point, bool, error) {
+	t.open = nil
+	state := t.current.redoChild
+	if state == nil {
+		return Point{}, false, nil
+	}
+	for _, c := range state.changes {
+		if err := c.apply(b); err != nil {
+			return Point{}, false, fmt.Errorf("redo: %w", err)
+		}
+	}
+	t.current = state
+	if len(state.changes) == 0 {
+		return state.cursor, true, nil
+	}
+	return b.PointAt(state.changes[0].offset), true, nil
+}
+
+// Earlier moves count states back in time, regardless of branch
+func (t *UndoTree) Earlier(b Buffer, count int) (Point, bool, error) {
+	return t.goTo(b, max(t.current.seq-count, 0))
+}
+
+// Later moves count states forward in time, regardless of branch
+func (t *UndoTree) Later(b Buffer, count int) (Point, bool, error) {
+	return t.goTo(b, min(t.current.seq+count, len(t.states)-1))
+}
+
+// goTo moves to the state with the given sequence number by undoing up to
+// the common ancestor and redoing down the target's branch
+func (t *UndoTree) goTo(b Buffer, seq int) (Point, bool, error) {
+	t.open = nil
+	target := t.states[seq]
+	if target == t.current {
+		return Point{}, false, nil
+	}
+
+	ancestors := map[*undoState]bool{}
+	for s := target; s != nil; s = s.parent {
+		ancestors[s] = true
+	}
+
+	cursor := t.current.cursor
+	for !ancestors[t.current] {
+		p, _, err := t.Undo(b)
+		if err != nil {
+			return Point{}, false, err
+		}
+		cursor = p
+	}
+
+	var path []*undoState
+	for s := target; s != t.current; s = s.parent {
+		path = append(path, s)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		t.current.redoChild = path[i]
+		p, _, err := t.Redo(b)
+		if err != nil {
+			return Point{}, false, err
+		}
+		cursor = p
+	}
+	return cursor, true, nil
+}
+
+// List describes the leaves of the undo tree, one per branch, in the same
+// form as Vim's :undolist
+func (t *UndoTree) List() string {
+	var sb strings.Builder
+	sb.WriteString("number changes  when")
+	for _, s := range t.states[1:] {
+		if len(s.children) > 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%6d %7d  %s", s.seq, len(s.changes), s.time.Format(time.TimeOnly))
+	}
+	return sb.String()
+}
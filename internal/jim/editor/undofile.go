@@ -0,0 +1,160 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const undoFileVersion = 1
+
+// undoFile is the on-disk representation of an undo tree. Hash is the hash
+// of the file contents the history applies to.
+type undoFile struct {
+	Version int    `json:"version"`
+	Hash    string `json:"hash"`
+	Current int    `json:"current"`
+	// RootRedoChild is the redo child of the root state, which isn't stored
+	RootRedoChild int             `json:"rootRedoChild"`
+	States        []undoFileState `json:"states"`
+}
+
+type undoFileState struct {
+	Seq       int            `json:"seq"`
+	Parent    int            `json:"parent"`
+	RedoChild int            `json:"redoChild"`
+	Row       int            `json:"row"`
+	Column    int            `json:"column"`
+	Time      time.Time      `json:"time"`
+	Changes   []undoFileEdit `json:"changes"`
+}
+
+type undoFileEdit struct {
+	Offset   int    `json:"offset"`
+	Deleted  string `json:"deleted,omitempty"`
+	Inserted string `json:"inserted,omitempty"`
+}
+
+// undoFilePath returns the path of the sidecar file that stores the undo
+// history for the file at path
+func undoFilePath(path string) string {
+	dir, name := filepath.Split(path)
+	return filepath.Join(dir, "."+name+".un~")
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeUndoFile persists the undo tree for the file at path, whose contents
+// have the given hash
+func writeUndoFile(path string, hash string, t *UndoTree) error {
+	uf := undoFile{
+		Version: undoFileVersion,
+		Hash:    hash,
+		Current: t.current.seq,
+	}
+	uf.RootRedoChild = -1
+	if t.root.redoChild != nil {
+		uf.RootRedoChild = t.root.redoChild.seq
+	}
+	for _, s := range t.states[1:] {
+		state := undoFileState{
+			Seq:       s.seq,
+			Parent:    s.parent.seq,
+			RedoChild: -1,
+			Row:       s.cursor.row,
+			Column:    s.cursor.column,
+			Time:      s.time,
+		}
+		if s.redoChild != nil {
+			state.RedoChild = s.redoChild.seq
+		}
+		for _, c := range s.changes {
+			state.Changes = append(state.Changes, undoFileEdit{Offset: c.offset, Deleted: c.deleted, Inserted: c.inserted})
+		}
+		uf.States = append(uf.States, state)
+	}
+
+	data, err := json.Marshal(uf)
+	if err != nil {
+		return fmt.Errorf("write undo file: %w", err)
+	}
+	if err := os.WriteFile(undoFilePath(path), data, 0600); err != nil {
+		return fmt.Errorf("write undo file: %w", err)
+	}
+	return nil
+}
+
+// readUndoFile restores the undo tree for the file at path. It returns a
+// nil tree if there is no undo file or it was written for different file
+// contents than the given hash.
+func readUndoFile(path string, hash string) (*UndoTree, error) {
+	data, err := os.ReadFile(undoFilePath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read undo file: %w", err)
+	}
+
+	var uf undoFile
+	if err := json.Unmarshal(data, &uf); err != nil {
+		return nil, fmt.Errorf("read undo file: %w", err)
+	}
+	if uf.Version != undoFileVersion || uf.Hash != hash {
+		return nil, nil
+	}
+
+	t := NewUndoTree()
+	for i, s := range uf.States {
+		if s.Seq != i+1 || s.Parent < 0 || s.Parent > i || len(s.Changes) == 0 {
+			return nil, fmt.Errorf("read undo file: invalid state %d", s.Seq)
+		}
+		parent := t.states[s.Parent]
+		state := &undoState{
+			seq:    s.Seq,
+			parent: parent,
+			cursor: Point{row: s.Row, column: s.Column},
+			time:   s.Time,
+		}
+		for _, c := range s.Changes {
+			state.changes = append(state.changes, change{offset: c.Offset, deleted: c.Deleted, inserted: c.Inserted})
+		}
+		parent.children = append(parent.children, state)
+		parent.redoChild = state
+		t.states = append(t.states, state)
+	}
+	// Redo children of -1 keep the most recent child
+	setRedoChild := func(s *undoState, seq int) error {
+		if seq < 0 {
+			return nil
+		}
+		for _, child := range s.children {
+			if child.seq == seq {
+				s.redoChild = child
+				return nil
+			}
+		}
+		return fmt.Errorf("read undo file: invalid redo child %d of state %d", seq, s.seq)
+	}
+	if err := setRedoChild(t.root, uf.RootRedoChild); err != nil {
+		return nil, err
+	}
+	for _, s := range uf.States {
+		if err := setRedoChild(t.states[s.Seq], s.RedoChild); err != nil {
+			return nil, err
+		}
+	}
+	if uf.Current < 0 || uf.Current >= len(t.states) {
+		return nil, fmt.Errorf("read undo file: invalid current state %d", uf.Current)
+	}
+	t.current = t.states[uf.Current]
+	return t, nil
+}
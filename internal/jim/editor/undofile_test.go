@@ -0,0 +1,65 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadUndoFileRejectsInvalidStates(t *testing.T) {
+	hash := contentHash(nil)
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"empty changes", `{"version":1,"hash":"` + hash + `","current":0,"rootRedoChild":1,
+			"states":[{"seq":1,"parent":0,"redoChild":-1,"changes":[]}]}`},
+		{"root as redo child", `{"version":1,"hash":"` + hash + `","current":0,"rootRedoChild":0,
+			"states":[{"seq":1,"parent":0,"redoChild":-1,"changes":[{"offset":0,"inserted":"a"}]}]}`},
+		{"redo child not a child", `{"version":1,"hash":"` + hash + `","current":0,"rootRedoChild":1,
+			"states":[{"seq":1,"parent":0,"redoChild":-1,"changes":[{"offset":0,"inserted":"a"}]},
+			{"seq":2,"parent":1,"redoChild":1,"changes":[{"offset":1,"inserted":"b"}]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(undoFilePath(path), []byte(tt.json), 0600); err != nil {
+				t.Fatal(err)
+			}
+			tree, err := readUndoFile(path, hash)
+			if err == nil || tree != nil {
+				t.Errorf("readUndoFile() = %v, %v, want an error", tree, err)
+			}
+		})
+	}
+}
+
+func TestReadUndoFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	b := NewMemoryBuffer(nil)
+	tree := b.UndoTree()
+	for _, c := range []change{{offset: 0, inserted: "a"}, {offset: 1, inserted: "b"}} {
+		if err := c.apply(b); err != nil {
+			t.Fatal(err)
+		}
+		tree.Record(c, Point{1, 1})
+	}
+	if _, _, err := tree.Undo(b); err != nil {
+		t.Fatal(err)
+	}
+	hash := contentHash([]byte(b.String()))
+	if err := writeUndoFile(path, hash, tree); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := readUndoFile(path, hash)
+	if err != nil || read == nil {
+		t.Fatalf("readUndoFile() = %v, %v", read, err)
+	}
+	if _, ok, err := read.Redo(b); !ok || err != nil {
+		t.Fatalf("Redo() = %v, %v", ok, err)
+	}
+	if got, want := b.Slice(0, 3), "ab"; got != want {
+		t.Errorf("after redo buffer = %q, want %q", got, want)
+	}
+}
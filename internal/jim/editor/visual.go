@@ -0,0 +1,198 @@
+package editor
+
+import (
+	"strings"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/modes"
+	"github.com/jstotz/jim/internal/jim/registers"
+)
+
+var selectionKinds = map[modes.Mode]selectionKind{
+	modes.ModeVisual:      selectionCharacters,
+	modes.ModeVisualLine:  selectionLines,
+	modes.ModeVisualBlock: selectionBlock,
+}
+
+// blockInsert is an insert on the first line of a visual block that is
+// repeated on the block's other lines when insert mode ends
+type blockInsert struct {
+	firstRow int
+	lastRow  int
+	column   int
+	// before is the content of the first line when the insert started
+	before string
+	// pad extends lines shorter than the column with spaces instead of
+	// skipping them
+	pad bool
+}
+
+// operateOnSelection applies an operator to the visual selection and returns
+// to normal mode
+func (e *Editor) operateOnSelection(op command.Operator) error {
+	w := e.FocusedWindow()
+	r := w.selectionRegion()
+	if err := e.activateMode(modes.ModeNormal); err != nil {
+		return err
+	}
+	if r.block {
+		return e.operateBlock(w, op, r)
+	}
+	return e.operate(w, op, r)
+}
+
+// selectTextObject extends the visual selection to cover a text object
+func (e *Editor) selectTextObject(obj command.TextObject, count int) error {
+	w := e.FocusedWindow()
+	r, ok := textObjectRegion(w.buffer, w.CurrentPosition(), obj, count)
+	if !ok {
+		return nil
+	}
+	if r.linewise {
+		w.selection.anchor = r.start
+		w.SetPosition(Point{row: r.end.row, column: 1})
+		if e.mode == modes.ModeVisual {
+			return e.activateMode(modes.ModeVisualLine)
+		}
+		return nil
+	}
+	w.selection.anchor = r.start
+	// The selection includes the character under the cursor, so stop on the
+	// last character of the object
+	end := newTextCursor(w.buffer, r.end)
+	if r.end != r.start {
+		end.prev()
+	}
+	w.SetPosition(end.point())
+	return nil
+}
+
+// operateBlock applies an operator to each line of a block region
+func (e *Editor) operateBlock(w *Window, op command.Operator, r region) error {
+	b := w.buffer
+	name := e.takeRegister()
+	var texts []string
+	for row := r.start.row; row <= r.end.row; row++ {
+		line, _ := bufferLine(b, row)
+		from, to := blockColumns(line, r)
+		texts = append(texts, line[from:to])
+	}
+
+	switch op {
+	case command.OperatorYank:
+		e.storeRegister(name, op, registers.Register{Text: strings.Join(texts, "\n"), Type: registers.Blockwise})
+	case command.OperatorDelete, command.OperatorChange:
+		e.storeRegister(name, op, registers.Register{Text: strings.Join(texts, "\n"), Type: registers.Blockwise})
+		history := b.UndoTree()
+		if op == command.OperatorChange {
+			// Changing a block deletes it and then inserts on each of its lines
+			if err := e.activateMode(modes.ModeInsert); err != nil {
+				return err
+			}
+		} else {
+			history.BeginGroup()
+			defer history.EndGroup()
+		}
+		for row := r.start.row; row <= r.end.row; row++ {
+			line, _ := bufferLine(b, row)
+			from, to := blockColumns(line, r)
+			if err := w.DeleteText(Point{row: row, column: from + 1}, to-from); err != nil {
+				return err
+			}
+		}
+		if op == command.OperatorChange {
+			first, _ := bufferLine(b, r.start.row)
+			e.blockInsert = &blockInsert{
+				firstRow: r.start.row,
+				lastRow:  r.end.row,
+				column:   min(r.start.column, len(first)+1),
+				before:   first,
+			}
+		}
+	case command.OperatorIndent, command.OperatorDedent:
+		return shiftLines(w, r.start.row, r.end.row, op == command.OperatorIndent)
+	case command.OperatorLowercase, command.OperatorUppercase:
+		history := b.UndoTree()
+		history.BeginGroup()
+		defer history.EndGroup()
+		for i, text := range texts {
+			converted := strings.ToLower(text)
+			if op == command.OperatorUppercase {
+				converted = strings.ToUpper(text)
+			}
+			if converted == text {
+				continue
+			}
+			line, _ := bufferLine(b, r.start.row+i)
+			from, to := blockColumns(line, r)
+			start := b.Offset(Point{row: r.start.row + i, column: from + 1})
+			if err := replaceText(w, start, start+to-from, converted); err != nil {
+				return err
+			}
+		}
+	}
+	line, _ := bufferLine(b, r.start.row)
+	w.SetPosition(Point{row: r.start.row, column: min(r.start.column, len(line)+1)})
+	return nil
+}
+
+// beginBlockInsert starts inserting before or after the visual block
+func (e *Editor) beginBlockInsert(after bool) error {
+	w := e.FocusedWindow()
+	if w.selection == nil || w.selection.kind != selectionBlock {
+		return nil
+	}
+	r := w.selectionRegion()
+	first, _ := bufferLine(w.buffer, r.start.row)
+	column := min(r.start.column, len(first)+1)
+	if after {
+		_, to := blockColumns(first, r)
+		column = to + 1
+	}
+	e.blockInsert = &blockInsert{
+		firstRow: r.start.row,
+		lastRow:  r.end.row,
+		column:   column,
+		before:   first,
+		pad:      after,
+	}
+	if err := e.activateMode(modes.ModeInsert); err != nil {
+		return err
+	}
+	w.SetPosition(Point{row: r.start.row, column: column})
+	return nil
+}
+
+// finishBlockInsert repeats the text typed on the first line of a block
+// insert on the block's other lines. Nothing is repeated if more than the
+// first line was changed.
+func (e *Editor) finishBlockInsert() error {
+	bi := e.blockInsert
+	e.blockInsert = nil
+	w := e.FocusedWindow()
+	line, _ := bufferLine(w.buffer, bi.firstRow)
+	c := bi.column - 1
+	added := len(line) - len(bi.before)
+	if added <= 0 || line[:c] != bi.before[:c] || line[c+added:] != bi.before[c:] {
+		return nil
+	}
+	text := line[c : c+added]
+	for row := bi.firstRow + 1; row <= bi.lastRow; row++ {
+		content, ok := bufferLine(w.buffer, row)
+		if !ok {
+			break
+		}
+		insert, column := text, bi.column
+		if len(content) < c {
+			if !bi.pad {
+				continue
+			}
+			insert, column = strings.Repeat(" ", c-len(content))+text, len(content)+1
+		}
+		if err := w.InsertText(Point{row: row, column: column}, insert); err != nil {
+			return err
+		}
+	}
+	w.SetPosition(Point{row: bi.firstRow, column: bi.column})
+	return nil
+}
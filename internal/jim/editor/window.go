@@ -3,6 +3,7 @@ package editor
 import (
 	"fmt"
 	"log/slog"
+	"regexp"
 	"strings"
 )
 
@@ -15,6 +16,10 @@ type Window struct {
 	height       int
 	rowOffset    int
 	columnOffset int
+	// selection is the selected text in visual mode, or nil
+	selection *selection
+	// highlight is the search pattern whose matches are highlighted, or nil
+	highlight *regexp.Regexp
 }
 
 func NewWindow(buffer Buffer, rowOffset int, columnOffset int, width int, height int, logger *slog.Logger) *Window {
@@ -31,25 +36,40 @@ func NewWindow(buffer Buffer, rowOffset int, columnOffset int, width int, height
 }
 
 func (w *Window) MoveCursorRelative(deltaRow int, deltaColumn int) {
-	newRow := w.cursor.row + deltaRow
-	newColumn := w.cursor.column + deltaColumn
+	p := w.CurrentPosition()
+	newRow := p.row + deltaRow
 	if newRow < 1 {
 		newRow = 1
-		w.shiftVisibleLines(int64(deltaRow))
 	}
-	if newRow > w.height {
-		newRow = w.height
-		w.shiftVisibleLines(int64(deltaRow))
+	// Only count the lines when moving past the end, which is expensive for
+	// large files that haven't been fully indexed
+	if len(w.buffer.LinesInRange(LineRange{int64(newRow), int64(newRow)})) == 0 {
+		newRow = w.buffer.LineCount()
 	}
-	if newColumn < 1 {
-		newColumn = 1
+	// Allow the cursor one column past the end of the line so text can be appended
+	line, _ := bufferLine(w.buffer, newRow)
+	w.SetPosition(Point{newRow, moveColumn(line, p.column, deltaColumn)})
+}
+
+// SetPosition moves the cursor to the given buffer position, scrolling the
+// visible lines if the position is outside of them
+func (w *Window) SetPosition(p Point) {
+	row := int64(p.row)
+	if row < w.visibleLines.start {
+		w.shiftVisibleLines(row - w.visibleLines.start)
 	}
-	// FIX:: This should actually be based on the current line length
-	if newColumn > w.width {
-		newColumn = w.width
+	if row > w.visibleLines.end {
+		w.shiftVisibleLines(row - w.visibleLines.end)
 	}
+	w.MoveCursor(Point{int(row-w.visibleLines.start) + 1, p.column})
+}
 
-	w.MoveCursor(Point{newRow, newColumn})
+func (w *Window) lineLength(row int) int {
+	lines := w.buffer.LinesInRange(LineRange{int64(row), int64(row)})
+	if len(lines) == 0 {
+		return 0
+	}
+	return len(lines[0].content)
 }
 
 func (w *Window) Clear() {
@@ -58,23 +78,42 @@ func (w *Window) Clear() {
 }
 
 func (w *Window) InsertText(p Point, text string) error {
+	c := change{offset: w.buffer.Offset(p), inserted: text}
 	if err := w.buffer.InsertText(p, text); err != nil {
 		return err
 	}
-	w.MoveCursorRelative(0, len(text))
+	w.recordChange(c, p)
+	w.SetPosition(w.buffer.PointAt(c.offset + len(text)))
 	return nil
 }
 
 func (w *Window) DeleteText(p Point, length int) error {
+	start := w.buffer.Offset(p)
+	end := start + length
+	if length < 0 {
+		start, end = max(end, 0), start
+	}
+	c := change{offset: start, deleted: w.buffer.Slice(start, end)}
 	if err := w.buffer.DeleteText(p, length); err != nil {
 		return err
 	}
+	w.recordChange(c, p)
+	// Deleting backward leaves the cursor at the start of the deleted text
 	if length < 0 {
-		w.MoveCursorRelative(0, length)
+		w.SetPosition(w.buffer.PointAt(start))
 	}
 	return nil
 }
 
+// recordChange adds a change made at the given cursor position to the undo
+// history of the buffer
+func (w *Window) recordChange(c change, cursor Point) {
+	if c.inserted == "" && c.deleted == "" {
+		return
+	}
+	w.buffer.UndoTree().Record(c, cursor)
+}
+
 func (w *Window) shiftVisibleLines(n int64) {
 	w.logger.Debug(fmt.Sprintf("shifting visible lines by n: %d (%+v)", n, w.visibleLines))
 	if w.visibleLines.start+n < 1 {
@@ -92,10 +131,27 @@ func (w *Window) MoveCursor(point Point) {
 }
 
 func (w *Window) LoadBuffer(b Buffer) error {
-	w.buffer = b
+	w.SetBuffer(b)
 	return b.Load()
 }
 
+// resize moves the window to another place on the screen and changes its
+// size, scrolling to keep the cursor's line visible
+func (w *Window) resize(rowOffset, columnOffset, width, height int) {
+	p := w.CurrentPosition()
+	w.rowOffset, w.columnOffset = rowOffset, columnOffset
+	w.width, w.height = width, height
+	w.visibleLines.end = w.visibleLines.start + int64(height) - 1
+	w.SetPosition(p)
+}
+
+// SetBuffer shows another buffer in the window, from its first line
+func (w *Window) SetBuffer(b Buffer) {
+	w.buffer = b
+	w.cursor = Point{1, 1}
+	w.visibleLines = LineRange{1, int64(w.height)}
+}
+
 func (w *Window) CurrentPosition() Point {
 	return Point{
 		// TODO: figure out types here
@@ -109,7 +165,13 @@ func (w *Window) Render() string {
 	var sb strings.Builder
 	lines := w.buffer.LinesInRange(w.visibleLines)
 	for idx, line := range lines {
-		sb.WriteString(line.content)
+		if w.selection != nil {
+			sb.WriteString(w.renderSelected(int(line.number), line.content))
+		} else if w.highlight != nil {
+			sb.WriteString(w.renderMatches(line.content))
+		} else {
+			sb.WriteString(line.content)
+		}
 		if idx < len(lines)-1 {
 			sb.WriteString("\r\n")
 		}
@@ -0,0 +1,441 @@
+package excmd
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/registers"
+)
+
+// cmdline is what was typed around the name of a command
+type cmdline struct {
+	first int
+	last  int
+	// ranged is whether a range was typed. Without one, first and last are
+	// the current line.
+	ranged bool
+	bang   bool
+	// vertical is whether the command was preceded by :vertical, which makes
+	// :split and :resize work on windows side by side
+	vertical bool
+	args     string
+	// argStart and argEnd are where the arguments are in the line
+	argStart int
+	argEnd   int
+}
+
+// spec describes an ex command. Its name can be abbreviated down to its first
+// minLength characters.
+type spec struct {
+	name      string
+	minLength int
+	// bang is whether the command takes a ! after its name
+	bang bool
+	// ranged is whether the command takes a range
+	ranged bool
+	// zero is whether line 0 in the range means before the first line
+	// instead of the first line
+	zero bool
+	// wholeLine commands take the rest of the line as their argument, |
+	// included
+	wholeLine bool
+	parse     func(p *parser, c *cmdline) (command.Command, error)
+}
+
+// specs are the commands the command line understands. Names are matched in
+// order, so a command comes before the ones sharing its shortest
+// abbreviation.
+var specs = []spec{
+	{name: "substitute", minLength: 1, ranged: true, parse: parseSubstitute},
+	{name: "set", minLength: 2, parse: parseSet},
+	{name: "write", minLength: 1, bang: true, ranged: true, parse: parseWrite(command.Write{})},
+	{name: "wq", minLength: 2, bang: true, ranged: true, parse: parseWrite(command.Write{Quit: true})},
+	{name: "wall", minLength: 2, parse: noArgs(command.WriteAll{})},
+	{name: "wqall", minLength: 3, parse: noArgs(command.WriteAll{Quit: true})},
+	{name: "xit", minLength: 1, bang: true, ranged: true, parse: parseWrite(command.Write{Modified: true, Quit: true})},
+	{name: "xall", minLength: 2, parse: noArgs(command.WriteAll{Quit: true})},
+	{name: "exit", minLength: 3, bang: true, ranged: true, parse: parseWrite(command.Write{Modified: true, Quit: true})},
+	{name: "update", minLength: 2, bang: true, ranged: true, parse: parseWrite(command.Write{Modified: true})},
+	{name: "saveas", minLength: 3, bang: true, parse: parseSaveAs},
+	{name: "edit", minLength: 1, bang: true, parse: parseEdit},
+	{name: "read", minLength: 1, ranged: true, zero: true, parse: parseRead},
+	{name: "buffer", minLength: 1, parse: parseBuffer},
+	{name: "buffers", minLength: 7, parse: noArgs(command.ShowBuffers{})},
+	{name: "bnext", minLength: 2, parse: parseBufferCount(1)},
+	{name: "bNext", minLength: 2, parse: parseBufferCount(-1)},
+	{name: "bprevious", minLength: 2, parse: parseBufferCount(-1)},
+	{name: "bdelete", minLength: 2, bang: true, parse: parseBufferDelete},
+	{name: "ls", minLength: 2, parse: noArgs(command.ShowBuffers{})},
+	{name: "files", minLength: 5, parse: noArgs(command.ShowBuffers{})},
+	{name: "split", minLength: 2, parse: parseSplit(false)},
+	{name: "vsplit", minLength: 2, parse: parseSplit(true)},
+	{name: "resize", minLength: 3, parse: parseResize},
+	{name: "only", minLength: 2, parse: noArgs(command.OnlyWindow{})},
+	{name: "close", minLength: 3, parse: noArgs(command.CloseWindow{})},
+	{name: "quit", minLength: 1, bang: true, parse: parseQuit(false)},
+	{name: "qall", minLength: 2, bang: true, parse: parseQuit(true)},
+	{name: "quitall", minLength: 5, bang: true, parse: parseQuit(true)},
+	{name: "delete", minLength: 1, ranged: true, parse: parseDelete},
+	{name: "move", minLength: 1, ranged: true, parse: parseCopy(true)},
+	{name: "copy", minLength: 2, ranged: true, parse: parseCopy(false)},
+	{name: "t", minLength: 1, ranged: true, parse: parseCopy(false)},
+	{name: "normal", minLength: 4, bang: true, ranged: true, wholeLine: true, parse: parseNormal},
+	{name: "global", minLength: 1, bang: true, ranged: true, wholeLine: true, parse: parseGlobal(false)},
+	{name: "vglobal", minLength: 1, ranged: true, wholeLine: true, parse: parseGlobal(true)},
+	{name: "lua", minLength: 3, wholeLine: true, parse: func(p *parser, c *cmdline) (command.Command, error) {
+		return command.EvalLua{Script: c.args}, nil
+	}},
+	{name: "checktime", minLength: 6, parse: noArgs(command.CheckTime{})},
+	{name: "undolist", minLength: 5, parse: noArgs(command.UndoList{})},
+	{name: "registers", minLength: 3, parse: noArgs(command.ShowRegisters{})},
+	{name: "display", minLength: 2, parse: noArgs(command.ShowRegisters{})},
+	{name: "nohlsearch", minLength: 3, parse: noArgs(command.NoHighlight{})},
+	{name: "earlier", minLength: 2, parse: func(p *parser, c *cmdline) (command.Command, error) {
+		count, err := p.parseCount(c)
+		return command.UndoEarlier{Count: count}, err
+	}},
+	{name: "later", minLength: 3, parse: func(p *parser, c *cmdline) (command.Command, error) {
+		count, err := p.parseCount(c)
+		return command.UndoLater{Count: count}, err
+	}},
+}
+
+// lookup finds the command a name or abbreviation stands for
+func lookup(name string) (spec, bool) {
+	if name == "" {
+		return spec{}, false
+	}
+	for _, s := range specs {
+		if len(name) >= s.minLength && strings.HasPrefix(s.name, name) {
+			return s, true
+		}
+	}
+	return spec{}, false
+}
+
+// noArgs returns a parser for a command that takes no arguments
+func noArgs(cmd command.Command) func(p *parser, c *cmdline) (command.Command, error) {
+	return func(p *parser, c *cmdline) (command.Command, error) {
+		if c.args != "" {
+			return command.Noop{}, p.trailing(c.argStart)
+		}
+		return cmd, nil
+	}
+}
+
+// trailing returns the error for unexpected text from pos
+func (p *parser) trailing(pos int) error {
+	return p.errorf(pos, "E488: Trailing characters: %s", strings.TrimSpace(p.line[pos:]))
+}
+
+// parseCount parses the optional count argument of commands such as
+// :earlier and :bnext
+func (p *parser) parseCount(c *cmdline) (int, error) {
+	if c.args == "" {
+		return 1, nil
+	}
+	p.pos = c.argStart
+	n, ok := p.digits()
+	if !ok || p.pos < c.argStart+len(c.args) {
+		return 0, p.trailing(p.pos)
+	}
+	return n, nil
+}
+
+// parseRangeCount parses an optional count at the current position, which
+// makes a command apply to count lines from the last line of its range. It
+// returns an error if anything else follows.
+func (p *parser) parseRangeCount(c *cmdline) error {
+	p.skip(" \t")
+	end := c.argStart + len(c.args)
+	if p.pos >= end {
+		return nil
+	}
+	start := p.pos
+	count, ok := p.digits()
+	if !ok || p.pos < end {
+		return p.trailing(start)
+	}
+	if count < 1 {
+		return p.errorf(start, "E939: Positive count required")
+	}
+	c.first = c.last
+	c.last = min(c.last+count-1, p.buf.LineCount())
+	return nil
+}
+
+// parseSet parses :set, which takes any number of options
+func parseSet(p *parser, c *cmdline) (command.Command, error) {
+	args := Tokenize(c.args)
+	if len(args) <= 1 {
+		return command.SetOption{Arg: c.args}, nil
+	}
+	var cmds []command.Command
+	for _, arg := range args {
+		cmds = append(cmds, command.SetOption{Arg: arg})
+	}
+	return command.Sequence{Commands: cmds}, nil
+}
+
+// parseDelete parses :d, which takes an optional register and count
+func parseDelete(p *parser, c *cmdline) (command.Command, error) {
+	p.pos = c.argStart
+	register := registers.Unnamed
+	if r := p.peek(); r != 0 && !unicode.IsDigit(r) && registers.Valid(r) {
+		register = r
+		p.pos += utf8.RuneLen(r)
+	}
+	if err := p.parseRangeCount(c); err != nil {
+		return command.Noop{}, err
+	}
+	return command.DeleteLines{FirstLine: c.first, LastLine: c.last, Register: register}, nil
+}
+
+// parseCopy returns the parser for :copy or :move, which take the address
+// of the line to put the lines below
+func parseCopy(move bool) func(p *parser, c *cmdline) (command.Command, error) {
+	return func(p *parser, c *cmdline) (command.Command, error) {
+		p.pos = c.argStart
+		address, ok, err := p.parseAddress(p.buf.CurrentLine())
+		if err != nil {
+			return command.Noop{}, err
+		}
+		if !ok {
+			return command.Noop{}, p.errorf(c.argStart, "E14: Invalid address")
+		}
+		p.skip(" \t")
+		if p.pos < c.argStart+len(c.args) {
+			return command.Noop{}, p.trailing(p.pos)
+		}
+		if address < 0 || address > p.buf.LineCount() {
+			return command.Noop{}, p.errorf(c.argStart, "E16: Invalid range")
+		}
+		return command.CopyLines{FirstLine: c.first, LastLine: c.last, Address: address, Move: move}, nil
+	}
+}
+
+// parseNormal parses :normal. Without a range the keys are typed at the
+// cursor.
+func parseNormal(p *parser, c *cmdline) (command.Command, error) {
+	if !c.ranged {
+		return command.Normal{Keys: c.args}, nil
+	}
+	return command.Normal{FirstLine: c.first, LastLine: c.last, Keys: c.args}, nil
+}
+
+// parseGlobal returns the parser for :g, or :v if invert is set, which take
+// "/pattern/command". :g! is the same as :v. Without a range the command
+// runs on the whole buffer.
+func parseGlobal(invert bool) func(p *parser, c *cmdline) (command.Command, error) {
+	return func(p *parser, c *cmdline) (command.Command, error) {
+		p.pos = c.argStart
+		delim := p.peek()
+		if delim == 0 {
+			return command.Noop{}, p.errorf(c.argStart, "E35: No previous regular expression")
+		}
+		if err := p.checkDelimiter(delim); err != nil {
+			return command.Noop{}, err
+		}
+		p.pos += utf8.RuneLen(delim)
+		pattern := p.delimited(delim, c.argEnd)
+		cmd := command.Global{FirstLine: c.first, LastLine: c.last, Pattern: pattern, Command: p.line[p.pos:c.argEnd], Invert: invert || c.bang}
+		if !c.ranged {
+			cmd.FirstLine, cmd.LastLine = 1, p.buf.LineCount()
+		}
+		return cmd, nil
+	}
+}
+
+// checkDelimiter checks the character at the current position can delimit
+// the pattern of :s or :g. Any punctuation other than \, " and | can.
+func (p *parser) checkDelimiter(delim rune) error {
+	if delim > unicode.MaxASCII || unicode.IsLetter(delim) || unicode.IsDigit(delim) || unicode.IsSpace(delim) || strings.ContainsRune(`\"|`, delim) {
+		return p.errorf(p.pos, "E146: Regular expressions can't be delimited by letters")
+	}
+	return nil
+}
+
+// parseSubstitute parses :s, "/pattern/replacement/flags" followed by an
+// optional count. Without arguments it repeats the last substitution.
+func parseSubstitute(p *parser, c *cmdline) (command.Command, error) {
+	if c.args == "" {
+		return command.Substitute{FirstLine: c.first, LastLine: c.last, Repeat: true}, nil
+	}
+	p.pos = c.argStart
+	delim := p.peek()
+	if err := p.checkDelimiter(delim); err != nil {
+		return command.Noop{}, err
+	}
+	p.pos += utf8.RuneLen(delim)
+	end := c.argStart + len(c.args)
+	cmd := command.Substitute{Pattern: p.delimited(delim, end)}
+	cmd.Replacement = p.delimited(delim, end)
+
+flags:
+	for ; p.pos < end; p.pos++ {
+		switch p.line[p.pos] {
+		case 'g':
+			cmd.Global = true
+		case 'c':
+			cmd.Confirm = true
+		case 'i':
+			cmd.IgnoreCase = true
+		case 'I':
+			cmd.MatchCase = true
+		case 'n':
+			cmd.CountOnly = true
+		default:
+			break flags
+		}
+	}
+	if err := p.parseRangeCount(c); err != nil {
+		return command.Noop{}, err
+	}
+	cmd.FirstLine, cmd.LastLine = c.first, c.last
+	return cmd, nil
+}
+
+// fileArg parses the file name argument of a command, which is empty if
+// there is none. Spaces in the name are escaped with a backslash.
+func (p *parser) fileArg(c *cmdline) (string, error) {
+	end := c.argStart + len(c.args)
+	p.skip(" \t")
+	if p.peek() == '!' {
+		return "", p.errorf(p.pos, "Filtering through a shell command is not supported")
+	}
+	names := Tokenize(p.line[p.pos:end])
+	switch len(names) {
+	case 0:
+		return "", nil
+	case 1:
+		return names[0], nil
+	default:
+		return "", p.errorf(p.pos, "E172: Only one file name allowed")
+	}
+}
+
+// parseWrite returns the parser for :write and the commands that write and
+// quit, which take ">>" to append and a file name. Without a range the whole
+// buffer is written.
+func parseWrite(write command.Write) func(p *parser, c *cmdline) (command.Command, error) {
+	return func(p *parser, c *cmdline) (command.Command, error) {
+		cmd := write
+		if c.ranged {
+			cmd.FirstLine, cmd.LastLine = c.first, c.last
+		}
+		cmd.Force = c.bang
+		p.pos = c.argStart
+		if strings.HasPrefix(c.args, ">>") {
+			cmd.Append = true
+			p.pos += len(">>")
+		}
+		path, err := p.fileArg(c)
+		cmd.Path = path
+		return cmd, err
+	}
+}
+
+// parseSaveAs parses :saveas, which requires a file name
+func parseSaveAs(p *parser, c *cmdline) (command.Command, error) {
+	p.pos = c.argStart
+	path, err := p.fileArg(c)
+	if err != nil {
+		return command.Noop{}, err
+	}
+	if path == "" {
+		return command.Noop{}, p.errorf(c.argStart, "E471: Argument required")
+	}
+	return command.SaveAs{Path: path, Force: c.bang}, nil
+}
+
+// parseEdit parses :edit, which takes an optional file name
+func parseEdit(p *parser, c *cmdline) (command.Command, error) {
+	p.pos = c.argStart
+	path, err := p.fileArg(c)
+	return command.Edit{Path: path, Force: c.bang}, err
+}
+
+// parseRead parses :read, which puts the lines of a file below the last line
+// of its range
+func parseRead(p *parser, c *cmdline) (command.Command, error) {
+	p.pos = c.argStart
+	path, err := p.fileArg(c)
+	return command.Read{Line: c.last, Path: path}, err
+}
+
+// parseQuit returns the parser for :quit, or :qall if all is set
+func parseQuit(all bool) func(p *parser, c *cmdline) (command.Command, error) {
+	return func(p *parser, c *cmdline) (command.Command, error) {
+		return noArgs(command.Quit{Force: c.bang, All: all})(p, c)
+	}
+}
+
+// bufferArg parses the argument naming a buffer: its number, or part of its
+// name. Both are empty without an argument.
+func bufferArg(c *cmdline) (int, string) {
+	if c.args == "" {
+		return 0, ""
+	}
+	if n, err := strconv.Atoi(c.args); err == nil && n > 0 {
+		return n, ""
+	}
+	return 0, c.args
+}
+
+// parseBuffer parses :buffer
+func parseBuffer(p *parser, c *cmdline) (command.Command, error) {
+	number, name := bufferArg(c)
+	return command.SwitchBuffer{Number: number, Name: name}, nil
+}
+
+// parseBufferDelete parses :bdelete
+func parseBufferDelete(p *parser, c *cmdline) (command.Command, error) {
+	number, name := bufferArg(c)
+	return command.DeleteBuffer{Number: number, Name: name, Force: c.bang}, nil
+}
+
+// parseBufferCount returns the parser for :bnext, or :bprevious if step is
+// -1, which take the number of buffers to move by
+func parseBufferCount(step int) func(p *parser, c *cmdline) (command.Command, error) {
+	return func(p *parser, c *cmdline) (command.Command, error) {
+		count, err := p.parseCount(c)
+		return command.SwitchBufferRelative{Delta: step * count}, err
+	}
+}
+
+// parseSplit returns the parser for :split, or :vsplit if vertical is set,
+// which take an optional file name. :vertical split is the same as :vsplit.
+func parseSplit(vertical bool) func(p *parser, c *cmdline) (command.Command, error) {
+	return func(p *parser, c *cmdline) (command.Command, error) {
+		p.pos = c.argStart
+		path, err := p.fileArg(c)
+		return command.SplitWindow{Vertical: vertical || c.vertical, Path: path}, err
+	}
+}
+
+// parseResize parses :resize. A size of +N or -N is relative to the current
+// size, and without a size the window is made as large as possible.
+func parseResize(p *parser, c *cmdline) (command.Command, error) {
+	if c.args == "" {
+		return command.ResizeWindow{Absolute: true, Vertical: c.vertical}, nil
+	}
+	p.pos = c.argStart
+	sign := p.peek()
+	if sign == '+' || sign == '-' {
+		p.pos++
+	}
+	n, ok := p.digits()
+	if !ok || p.pos < c.argStart+len(c.args) {
+		return command.Noop{}, p.trailing(c.argStart)
+	}
+	switch sign {
+	case '+':
+		return command.ResizeWindow{Delta: n, Vertical: c.vertical}, nil
+	case '-':
+		return command.ResizeWindow{Delta: -n, Vertical: c.vertical}, nil
+	}
+	return command.ResizeWindow{Delta: n, Absolute: true, Vertical: c.vertical}, nil
+}
@@ -0,0 +1,233 @@
+// Package excmd parses the ex commands typed on the command line into
+// editor commands
+package excmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jstotz/jim/internal/jim/command"
+)
+
+// Buffer is the buffer the addresses in a command line refer to
+type Buffer interface {
+	// CurrentLine returns the line the cursor is on
+	CurrentLine() int
+	LineCount() int
+	// Mark returns the line of a mark, or false if it isn't set
+	Mark(name rune) (int, bool)
+	// Search returns the first line after line that matches a pattern, or
+	// the last one before it if backward is set, wrapping around the ends
+	// of the buffer. An empty pattern is the last pattern searched for.
+	Search(pattern string, line int, backward bool) (int, error)
+}
+
+// Error is an error in a command line, at a column counted in characters
+// from 1
+type Error struct {
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (column %d)", e.Message, e.Column)
+}
+
+// parser reads a command line from left to right
+type parser struct {
+	buf  Buffer
+	line string
+	pos  int
+}
+
+// Parse parses the first command of a command line: an optional range, the
+// name of the command or an abbreviation of it, an optional ! and its
+// arguments. A range on its own moves to its last line. The name can be
+// preceded by :vertical.
+//
+// Commands after a | are returned unparsed in a command.Ex that follows the
+// first command, so that their addresses refer to the buffer as the commands
+// before them leave it. Commands such as :global and :normal take the rest of
+// the line as their argument, | included.
+func Parse(line string, buf Buffer) (command.Command, error) {
+	p := &parser{buf: buf, line: line}
+	p.skip(" \t:")
+	r, err := p.parseRange()
+	if err != nil {
+		return command.Noop{}, err
+	}
+	p.skip(" \t")
+	if p.done() || p.peek() == '|' {
+		var cmd command.Command = command.Noop{}
+		if r.given {
+			if err := p.checkRange(r); err != nil {
+				return command.Noop{}, err
+			}
+			cmd = command.GotoLine{Line: max(r.last, 1)}
+		}
+		return p.chain(cmd, p.pos)
+	}
+
+	nameStart := p.pos
+	name := p.letters()
+	vertical := false
+	if len(name) >= 4 && strings.HasPrefix("vertical", name) {
+		vertical = true
+		p.skip(" \t")
+		nameStart = p.pos
+		name = p.letters()
+	}
+	s, ok := lookup(name)
+	if !ok {
+		return command.Noop{}, p.errorf(nameStart, "E492: Not an editor command: %s", strings.TrimSpace(line))
+	}
+	if r.given && !s.ranged {
+		return command.Noop{}, p.errorf(r.start, "E481: No range allowed")
+	}
+	if err := p.checkRange(r); err != nil {
+		return command.Noop{}, err
+	}
+	c := &cmdline{first: r.first, last: r.last, ranged: r.given, vertical: vertical}
+	if !s.zero {
+		c.first, c.last = max(c.first, 1), max(c.last, 1)
+	}
+	if s.bang && p.peek() == '!' {
+		c.bang = true
+		p.pos++
+	}
+	p.skip(" \t")
+	c.argStart = p.pos
+	c.argEnd = len(p.line)
+	next := -1
+	if !s.wholeLine {
+		if i := indexBar(p.line[p.pos:]); i >= 0 {
+			c.argEnd = p.pos + i
+			next = c.argEnd + 1
+		}
+	}
+	c.args = strings.TrimRight(p.line[c.argStart:c.argEnd], " \t")
+
+	cmd, err := s.parse(p, c)
+	if err != nil {
+		return command.Noop{}, err
+	}
+	if next < 0 {
+		return cmd, nil
+	}
+	return p.chain(cmd, next)
+}
+
+// chain returns cmd followed by the commands in the line from pos, if any
+func (p *parser) chain(cmd command.Command, pos int) (command.Command, error) {
+	if pos < len(p.line) && p.line[pos] == '|' {
+		pos++
+	}
+	rest := p.line[pos:]
+	if strings.TrimSpace(rest) == "" {
+		return cmd, nil
+	}
+	return command.Sequence{Commands: []command.Command{cmd, command.Ex{Line: rest, Column: p.column(pos)}}}, nil
+}
+
+// indexBar returns the index of the first | not escaped with a backslash, or
+// -1 if there is none
+func indexBar(s string) int {
+	escaped := false
+	for i, r := range s {
+		if r == '|' && !escaped {
+			return i
+		}
+		escaped = !escaped && r == '\\'
+	}
+	return -1
+}
+
+// Tokenize splits the arguments of a command at whitespace. A backslash
+// makes the character after it part of the argument, a space included.
+func Tokenize(args string) []string {
+	var tokens []string
+	var sb strings.Builder
+	inToken, escaped := false, false
+	for _, r := range args {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			inToken, escaped = true, true
+		case r == ' ' || r == '\t':
+			if inToken {
+				tokens = append(tokens, sb.String())
+				sb.Reset()
+				inToken = false
+			}
+		default:
+			sb.WriteRune(r)
+			inToken = true
+		}
+	}
+	if escaped {
+		sb.WriteRune('\\')
+	}
+	if inToken {
+		tokens = append(tokens, sb.String())
+	}
+	return tokens
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.line)
+}
+
+// peek returns the character at the current position, or 0 at the end
+func (p *parser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(p.line[p.pos:])
+	return r
+}
+
+// skip moves past any of the given characters
+func (p *parser) skip(chars string) {
+	for !p.done() && strings.ContainsRune(chars, p.peek()) {
+		p.pos++
+	}
+}
+
+// letters reads the letters at the current position
+func (p *parser) letters() string {
+	start := p.pos
+	for !p.done() {
+		r, size := utf8.DecodeRuneInString(p.line[p.pos:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		p.pos += size
+	}
+	return p.line[start:p.pos]
+}
+
+// digits reads the number at the current position, returning false if there
+// isn't one
+func (p *parser) digits() (int, bool) {
+	start := p.pos
+	n := 0
+	for !p.done() && p.line[p.pos] >= '0' && p.line[p.pos] <= '9' {
+		n = n*10 + int(p.line[p.pos]-'0')
+		p.pos++
+	}
+	return n, p.pos > start
+}
+
+// column returns the column of a byte offset into the line
+func (p *parser) column(pos int) int {
+	return utf8.RuneCountInString(p.line[:pos]) + 1
+}
+
+// errorf returns an Error at the column of a byte offset into the line
+func (p *parser) errorf(pos int, format string, args ...any) error {
+	return &Error{Column: p.column(pos), Message: fmt.Sprintf(format, args...)}
+}
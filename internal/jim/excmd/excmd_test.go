@@ -0,0 +1,159 @@
+package excmd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jstotz/jim/internal/jim/command"
+)
+
+// testBuffer is a 20 line buffer with the cursor on line 5 and mark a on
+// line 3. Patterns are line numbers: searching for "12" finds line 12.
+type testBuffer struct{}
+
+func (testBuffer) CurrentLine() int { return 5 }
+
+func (testBuffer) LineCount() int { return 20 }
+
+func (testBuffer) Mark(name rune) (int, bool) {
+	return 3, name == 'a'
+}
+
+func (testBuffer) Search(pattern string, line int, backward bool) (int, error) {
+	if pattern == "" {
+		pattern = "10"
+	}
+	var n int
+	if _, err := fmt.Sscan(pattern, &n); err != nil {
+		return 0, fmt.Errorf("E486: Pattern not found: %s", pattern)
+	}
+	return n, nil
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		line        string
+		first, last int
+	}{
+		{"d", 5, 5},
+		{"3d", 3, 3},
+		{".d", 5, 5},
+		{"$d", 20, 20},
+		{"%d", 1, 20},
+		{"2,4d", 2, 4},
+		{"4,2d", 2, 4},
+		{".,$d", 5, 20},
+		{"'a,.d", 3, 5},
+		{"+d", 6, 6},
+		{"-2d", 3, 3},
+		{".+2,$-1d", 7, 19},
+		{"3++d", 5, 5},
+		{".5d", 10, 10},
+		{",7d", 5, 7},
+		{"2,d", 2, 5},
+		{"1,2,3d", 2, 3},
+		{"2;+3d", 2, 5},
+		{"2,+3d", 2, 8},
+		{"/12/d", 12, 12},
+		{"/12/+1d", 13, 13},
+		{"?4?,/12/d", 4, 12},
+		{`\/d`, 10, 10},
+		{" : 2 , 4 d", 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			cmd, err := Parse(tt.line, testBuffer{})
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.line, err)
+			}
+			want := command.DeleteLines{FirstLine: tt.first, LastLine: tt.last, Register: '"'}
+			if !reflect.DeepEqual(cmd, want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.line, cmd, want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want command.Command
+	}{
+		{"", command.Noop{}},
+		{"7", command.GotoLine{Line: 7}},
+		{"0", command.GotoLine{Line: 1}},
+		{"$", command.GotoLine{Line: 20}},
+		{"d x", command.DeleteLines{FirstLine: 5, LastLine: 5, Register: 'x'}},
+		{"2,3m0", command.CopyLines{FirstLine: 2, LastLine: 3, Address: 0, Move: true}},
+		{"t$", command.CopyLines{FirstLine: 5, LastLine: 5, Address: 20}},
+		{"w! out.txt", command.Write{Path: "out.txt", Force: true}},
+		{"2,3w >> out.txt", command.Write{FirstLine: 2, LastLine: 3, Path: "out.txt", Append: true}},
+		{"q!", command.Quit{Force: true}},
+		{"qa", command.Quit{All: true}},
+		{"vert sp a.txt", command.SplitWindow{Vertical: true, Path: "a.txt"}},
+		{"d | 2d", command.Sequence{Commands: []command.Command{
+			command.DeleteLines{FirstLine: 5, LastLine: 5, Register: '"'},
+			command.Ex{Line: " 2d", Column: 4},
+		}}},
+		{"g/12/d | d", command.Global{FirstLine: 1, LastLine: 20, Pattern: "12", Command: "d | d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			cmd, err := Parse(tt.line, testBuffer{})
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.line, err)
+			}
+			if !reflect.DeepEqual(cmd, tt.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.line, cmd, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		line    string
+		message string
+		column  int
+	}{
+		{"21d", "E16: Invalid range", 1},
+		{"1,21d", "E16: Invalid range", 1},
+		{"'bd", "E20: Mark not set", 1},
+		{"2,/x/d", "E486: Pattern not found: x", 3},
+		{"frob", "E492: Not an editor command: frob", 1},
+		{"  2ls", "E481: No range allowed", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			_, err := Parse(tt.line, testBuffer{})
+			var exErr *Error
+			if !errors.As(err, &exErr) {
+				t.Fatalf("Parse(%q) error = %v, want an *Error", tt.line, err)
+			}
+			if exErr.Message != tt.message || exErr.Column != tt.column {
+				t.Errorf("Parse(%q) error = %q at %d, want %q at %d", tt.line, exErr.Message, exErr.Column, tt.message, tt.column)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"", nil},
+		{"a b", []string{"a", "b"}},
+		{"  a\t b  ", []string{"a", "b"}},
+		{`a\ b c`, []string{"a b", "c"}},
+		{`a\\`, []string{`a\`}},
+		{`a\`, []string{`a\`}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
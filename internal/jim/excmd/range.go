@@ -0,0 +1,161 @@
+package excmd
+
+import "unicode/utf8"
+
+// lineRange is the range of lines a command applies to. Without a range
+// both lines are the current line.
+type lineRange struct {
+	first int
+	last  int
+	given bool
+	// start is where the range was typed
+	start int
+}
+
+// parseRange parses a range: % for the whole buffer, or addresses separated
+// by commas or semicolons. After a semicolon the addresses that follow are
+// relative to the one before it instead of the cursor. When more than two
+// addresses are given the last two count.
+func (p *parser) parseRange() (lineRange, error) {
+	r := lineRange{start: p.pos}
+	current := p.buf.CurrentLine()
+	r.first, r.last = current, current
+	if p.peek() == '%' {
+		p.pos++
+		p.skip(" \t")
+		r.first, r.last, r.given = 1, p.buf.LineCount(), true
+		return r, nil
+	}
+
+	line, ok, err := p.parseAddress(current)
+	if err != nil {
+		return r, err
+	}
+	if ok {
+		r.first, r.last, r.given = line, line, true
+	}
+	for {
+		p.skip(" \t")
+		sep := p.peek()
+		if sep != ',' && sep != ';' {
+			break
+		}
+		p.pos++
+		p.skip(" \t")
+		if sep == ';' {
+			current = r.last
+		}
+		line, ok, err := p.parseAddress(current)
+		if err != nil {
+			return r, err
+		}
+		if !ok {
+			line = current
+		}
+		r.first, r.last, r.given = r.last, line, true
+	}
+	if r.first > r.last {
+		r.first, r.last = r.last, r.first
+	}
+	return r, nil
+}
+
+// checkRange checks that a range is inside the buffer. Line 0 is allowed
+// here; commands that don't put text before the first line treat it as line
+// 1.
+func (p *parser) checkRange(r lineRange) error {
+	if r.first < 0 || r.last > p.buf.LineCount() {
+		return p.errorf(r.start, "E16: Invalid range")
+	}
+	return nil
+}
+
+// parseAddress parses a line address: a line number, . for the current
+// line, $ for the last line, 'x for the line of mark x, /pattern/ for the
+// next line matching a pattern or ?pattern? for the previous one, and \/ or
+// \? for the next or previous line matching the last pattern searched for.
+// Any number of +N and -N offsets can follow, with N defaulting to 1, and
+// offsets alone are relative to the current line. It returns false if there
+// is no address at the current position.
+func (p *parser) parseAddress(current int) (int, bool, error) {
+	line, ok := current, false
+	start := p.pos
+	switch c := p.peek(); {
+	case c == '.':
+		p.pos++
+		ok = true
+	case c == '$':
+		p.pos++
+		line, ok = p.buf.LineCount(), true
+	case c >= '0' && c <= '9':
+		line, ok = p.digits()
+	case c == '\'':
+		p.pos++
+		name := p.peek()
+		if name == 0 {
+			return 0, false, p.errorf(start, "E20: Mark not set")
+		}
+		p.pos += utf8.RuneLen(name)
+		var set bool
+		if line, set = p.buf.Mark(name); !set {
+			return 0, false, p.errorf(start, "E20: Mark not set")
+		}
+		ok = true
+	case c == '/' || c == '?':
+		p.pos++
+		pattern := p.delimited(c, len(p.line))
+		var err error
+		if line, err = p.buf.Search(pattern, current, c == '?'); err != nil {
+			return 0, false, p.errorf(start, "%s", err)
+		}
+		ok = true
+	case c == '\\' && p.pos+1 < len(p.line) && (p.line[p.pos+1] == '/' || p.line[p.pos+1] == '?'):
+		backward := p.line[p.pos+1] == '?'
+		p.pos += 2
+		var err error
+		if line, err = p.buf.Search("", current, backward); err != nil {
+			return 0, false, p.errorf(start, "%s", err)
+		}
+		ok = true
+	}
+
+	for {
+		switch c := p.peek(); {
+		case c == '+' || c == '-':
+			p.pos++
+			n, given := p.digits()
+			if !given {
+				n = 1
+			}
+			if c == '-' {
+				n = -n
+			}
+			line += n
+			ok = true
+		case ok && c >= '0' && c <= '9':
+			// A number right after an address is an offset, as in .5
+			n, _ := p.digits()
+			line += n
+		default:
+			return line, ok, nil
+		}
+	}
+}
+
+// delimited reads up to the next delim that isn't escaped with a backslash,
+// and moves past the delimiter. Without one it reads up to end.
+func (p *parser) delimited(delim rune, end int) string {
+	start := p.pos
+	escaped := false
+	for p.pos < end {
+		r, size := utf8.DecodeRuneInString(p.line[p.pos:])
+		if r == delim && !escaped {
+			s := p.line[start:p.pos]
+			p.pos += size
+			return s
+		}
+		escaped = !escaped && r == '\\'
+		p.pos += size
+	}
+	return p.line[start:end]
+}
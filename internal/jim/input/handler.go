@@ -1,36 +1,195 @@
 package input
 
 import (
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/jstotz/jim/internal/jim/command"
 	"github.com/jstotz/jim/internal/jim/config"
+	"github.com/jstotz/jim/internal/jim/keys"
 	"github.com/jstotz/jim/internal/jim/modes"
 )
 
+// Handler turns keypresses into commands by matching them against the key
+// bindings of the current mode. Keys that start a longer binding are kept
+// pending until the binding is complete, can't match anymore, or the
+// caller times out waiting for the next key. In normal, operator-pending and
+// visual modes bindings may be preceded by a count. Bindings for commands that take
+// a character argument wait for one more key, without timing out.
 type Handler struct {
-	config config.Config
+	config  config.Config
+	tries   map[modes.Mode]*trieNode
+	pending []keys.Key
+	count   int
+	// argument is the command waiting for its character argument
+	argument command.CharArgument
 }
 
+// leaderPattern matches <leader> in key notation, which like the rest of
+// the notation ignores case
+var leaderPattern = regexp.MustCompile(`(?i)<leader>`)
+
 func NewHandler(cfg config.Config) *Handler {
+	tries := map[modes.Mode]*trieNode{}
+	for _, binding := range cfg.KeyBindings {
+		if tries[binding.Mode] == nil {
+			tries[binding.Mode] = newTrieNode()
+		}
+		notation := leaderPattern.ReplaceAllLiteralString(binding.Keys, string(cfg.Leader))
+		tries[binding.Mode].insert(keys.Parse(notation), binding.Command)
+	}
 	return &Handler{
 		config: cfg,
+		tries:  tries,
 	}
 }
 
-func (h *Handler) HandleKeyPress(mode modes.Mode, c rune) (command.Command, error) {
-	keyStr := string(c)
-	
-	// Find matching key binding for the current mode and key
-	for _, binding := range h.config.KeyBindings {
-		if binding.Mode == mode && binding.Keys == keyStr {
-			return binding.Command, nil
+// Pending reports whether the handler is waiting for more keys to complete
+// an ambiguous binding
+func (h *Handler) Pending() bool {
+	return len(h.pending) > 0 && h.argument == nil
+}
+
+// PendingKeys describes the count and keys typed so far for a binding that
+// hasn't completed
+func (h *Handler) PendingKeys() string {
+	var sb strings.Builder
+	if h.count > 0 {
+		sb.WriteString(strconv.Itoa(h.count))
+	}
+	sb.WriteString(keys.Format(h.pending))
+	return sb.String()
+}
+
+// Argument returns the command waiting for its character argument, or nil
+func (h *Handler) Argument() command.CharArgument {
+	return h.argument
+}
+
+// Reset discards the keys, count and command waiting to be completed
+func (h *Handler) Reset() {
+	h.reset()
+}
+
+func (h *Handler) HandleKeyPress(mode modes.Mode, k keys.Key) (command.Command, error) {
+	if h.argument != nil {
+		if !k.IsText() {
+			return h.unmatched(mode, nil), nil
 		}
+		return h.complete(h.argument.WithChar(k.Rune)), nil
+	}
+	if len(h.pending) == 0 && h.isCountDigit(mode, k) {
+		h.count = h.count*10 + int(k.Rune-'0')
+		return command.Noop{}, nil
+	}
+
+	h.pending = append(h.pending, k)
+	node := h.trie(mode).find(h.pending)
+	if node == nil {
+		return h.mismatch(mode)
+	}
+	if len(node.children) > 0 {
+		// Wait for the next key or a timeout to resolve the ambiguity
+		return command.Noop{}, nil
+	}
+	return h.complete(node.command), nil
+}
+
+// Timeout resolves pending keys after waiting too long for the next key,
+// running the binding for the keys typed so far if there is one
+func (h *Handler) Timeout(mode modes.Mode) command.Command {
+	if node := h.trie(mode).find(h.pending); node != nil && node.command != nil {
+		return h.complete(node.command)
+	}
+	return h.unmatched(mode, h.pending)
+}
+
+func (h *Handler) trie(mode modes.Mode) *trieNode {
+	if t, ok := h.tries[mode]; ok {
+		return t
+	}
+	return newTrieNode()
+}
+
+// isCountDigit reports whether k continues the count prefix. Zero can't
+// start a count so it can be bound on its own.
+func (h *Handler) isCountDigit(mode modes.Mode, k keys.Key) bool {
+	if mode != modes.ModeNormal && mode != modes.ModeOperatorPending && !mode.IsVisual() {
+		return false
+	}
+	if k.Code != keys.CodeRune || k.Modifiers != 0 {
+		return false
+	}
+	return (k.Rune >= '1' && k.Rune <= '9') || (k.Rune == '0' && h.count > 0)
+}
+
+// mismatch handles a key that doesn't continue any binding from the pending
+// keys before it. The binding for the keys before it runs if there is one,
+// and the key is then handled on its own.
+func (h *Handler) mismatch(mode modes.Mode) (command.Command, error) {
+	if len(h.pending) == 1 {
+		return h.unmatched(mode, h.pending), nil
+	}
+	prefix, last := h.pending[:len(h.pending)-1], h.pending[len(h.pending)-1]
+
+	var cmd command.Command
+	if node := h.trie(mode).find(prefix); node != nil && node.command != nil {
+		cmd = h.complete(node.command)
+	} else {
+		cmd = h.unmatched(mode, prefix)
+	}
+
+	next, err := h.HandleKeyPress(mode, last)
+	if err != nil {
+		return command.Noop{}, err
+	}
+	return command.Sequence{Commands: []command.Command{cmd, next}}, nil
+}
+
+// complete returns the command for a matched binding with the count applied.
+// Commands that take a character argument wait for it first.
+func (h *Handler) complete(cmd command.Command) command.Command {
+	if arg, ok := cmd.(command.CharArgument); ok && h.argument == nil {
+		h.argument = arg
+		return command.Noop{}
+	}
+	count := h.count
+	h.reset()
+	if count > 0 {
+		return command.Repeat{Count: count, Command: cmd}
 	}
+	return cmd
+}
 
-	// For insert and command modes, if no specific binding is found,
-	// default to inserting the character
-	if mode == modes.ModeInsert || mode == modes.ModeCommand {
-		return command.InsertText{Text: keyStr}, nil
+// unmatched returns the command for keys that aren't bound. In insert and
+// command modes characters and tabs are typed as text and other keys are
+// ignored. In operator-pending mode they cancel the operator.
+func (h *Handler) unmatched(mode modes.Mode, ks []keys.Key) command.Command {
+	h.reset()
+	if mode == modes.ModeOperatorPending {
+		return command.ActivateMode{Mode: modes.ModeNormal}
 	}
+	if mode != modes.ModeInsert && mode != modes.ModeCommand {
+		return command.Noop{}
+	}
+	var text strings.Builder
+	for _, k := range ks {
+		switch {
+		case k.IsText():
+			text.WriteRune(k.Rune)
+		case k.Code == keys.CodeTab && k.Modifiers == 0:
+			text.WriteByte('\t')
+		}
+	}
+	if text.Len() == 0 {
+		return command.Noop{}
+	}
+	return command.InsertText{Text: text.String()}
+}
 
-	return command.Noop{}, nil
+func (h *Handler) reset() {
+	h.pending = nil
+	h.count = 0
+	h.argument = nil
 }
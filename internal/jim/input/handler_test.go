@@ -0,0 +1,34 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/config"
+	"github.com/jstotz/jim/internal/jim/keys"
+	"github.com/jstotz/jim/internal/jim/modes"
+)
+
+func TestLeaderIgnoresCase(t *testing.T) {
+	for _, notation := range []string{"<leader>x", "<Leader>x", "<LEADER>x"} {
+		t.Run(notation, func(t *testing.T) {
+			cfg := config.Config{
+				Leader: ',',
+				KeyBindings: []config.KeyBinding{
+					{Mode: modes.ModeNormal, Keys: notation, Command: command.Undo{}},
+				},
+			}
+			h := NewHandler(cfg)
+			var cmd command.Command
+			for _, k := range keys.Parse(",x") {
+				var err error
+				if cmd, err = h.HandleKeyPress(modes.ModeNormal, k); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, ok := cmd.(command.Undo); !ok {
+				t.Errorf("typing ,x gave %#v, want the %s binding", cmd, notation)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package input
+
+import (
+	"github.com/jstotz/jim/internal/jim/command"
+	"github.com/jstotz/jim/internal/jim/keys"
+)
+
+// trieNode is a node in a tree of key sequences. A node's command is run
+// when its sequence is typed; nodes with children are prefixes of longer
+// sequences.
+type trieNode struct {
+	children map[keys.Key]*trieNode
+	command  command.Command
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: map[keys.Key]*trieNode{}}
+}
+
+func (n *trieNode) insert(ks []keys.Key, cmd command.Command) {
+	node := n
+	for _, k := range ks {
+		child, ok := node.children[k]
+		if !ok {
+			child = newTrieNode()
+			node.children[k] = child
+		}
+		node = child
+	}
+	node.command = cmd
+}
+
+// find returns the node for the given key sequence or nil if no binding
+// starts with it
+func (n *trieNode) find(ks []keys.Key) *trieNode {
+	node := n
+	for _, k := range ks {
+		node = node.children[k]
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
@@ -0,0 +1,227 @@
+package keys
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const esc = 0x1b
+
+// noKey is what sequences decode to that are consumed without being a key,
+// such as focus reports and replies to terminal queries
+var noKey = Key{}
+
+// Decoder turns the bytes a terminal in raw mode sends into keys. Escape
+// sequences for special keys are decoded into a single key. Since the escape
+// key sends the same byte that starts those sequences, a lone escape is only
+// reported once no more bytes have arrived within the escape timeout.
+type Decoder struct {
+	r          io.Reader
+	escTimeout time.Duration
+}
+
+func NewDecoder(r io.Reader, escTimeout time.Duration) *Decoder {
+	return &Decoder{r: r, escTimeout: escTimeout}
+}
+
+// Run reads from the decoder's reader and sends each decoded key on out until
+// reading fails, returning the read error
+func (d *Decoder) Run(out chan<- Key) error {
+	chunks := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			buf := make([]byte, 256)
+			n, err := d.r.Read(buf)
+			if n > 0 {
+				chunks <- buf[:n]
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	var pending []byte
+	for {
+		var timeout <-chan time.Time
+		if len(pending) > 0 {
+			timeout = time.After(d.escTimeout)
+		}
+		force := false
+		select {
+		case chunk := <-chunks:
+			pending = append(pending, chunk...)
+		case <-timeout:
+			force = true
+		case err := <-errs:
+			return err
+		}
+
+		for len(pending) > 0 {
+			k, n, ok := decode(pending, force)
+			if !ok {
+				break
+			}
+			if k != noKey {
+				out <- k
+			}
+			pending = pending[n:]
+		}
+	}
+}
+
+// decode decodes the first key in buf, returning the number of bytes it
+// used, or noKey if they aren't a key. It returns false if buf holds the
+// start of a longer sequence, unless force is set, in which case it decodes
+// as much as it can.
+func decode(buf []byte, force bool) (Key, int, bool) {
+	b := buf[0]
+	switch {
+	case b == esc:
+		return decodeEscape(buf, force)
+	case b == '\r' || b == '\n':
+		return Key{Code: CodeEnter}, 1, true
+	case b == '\t':
+		return Key{Code: CodeTab}, 1, true
+	case b == 0x7f || b == 0x08:
+		return Key{Code: CodeBackspace}, 1, true
+	case b == 0:
+		return Key{Code: CodeRune, Rune: ' ', Modifiers: ModCtrl}, 1, true
+	case b < 0x1b:
+		return Key{Code: CodeRune, Rune: rune('a' + b - 1), Modifiers: ModCtrl}, 1, true
+	case b < 0x20:
+		return Key{Code: CodeRune, Rune: rune(`\]^_`[b-0x1c]), Modifiers: ModCtrl}, 1, true
+	}
+
+	if !utf8.FullRune(buf) && !force {
+		return Key{}, 0, false
+	}
+	r, n := utf8.DecodeRune(buf)
+	return Rune(r), n, true
+}
+
+func decodeEscape(buf []byte, force bool) (Key, int, bool) {
+	if len(buf) == 1 {
+		if force {
+			return Key{Code: CodeEscape}, 1, true
+		}
+		return Key{}, 0, false
+	}
+
+	switch buf[1] {
+	case '[':
+		if k, n, ok := decodeCSI(buf); ok || !force {
+			return k, n, ok
+		}
+	case 'O':
+		if len(buf) >= 3 {
+			if code, ok := ss3Codes[buf[2]]; ok {
+				return Key{Code: code}, 3, true
+			}
+		} else if !force {
+			return Key{}, 0, false
+		}
+	}
+
+	// Escape followed by a key is how terminals send Alt combinations
+	if k, n, ok := decode(buf[1:], force); ok && buf[1] != esc {
+		k.Modifiers |= ModAlt
+		return k, n + 1, true
+	} else if !ok && !force {
+		return Key{}, 0, false
+	}
+	return Key{Code: CodeEscape}, 1, true
+}
+
+var ss3Codes = map[byte]Code{
+	'A': CodeUp,
+	'B': CodeDown,
+	'C': CodeRight,
+	'D': CodeLeft,
+	'H': CodeHome,
+	'F': CodeEnd,
+	'P': CodeF1,
+	'Q': CodeF2,
+	'R': CodeF3,
+	'S': CodeF4,
+}
+
+var csiLetterCodes = map[byte]Code{
+	'A': CodeUp,
+	'B': CodeDown,
+	'C': CodeRight,
+	'D': CodeLeft,
+	'H': CodeHome,
+	'F': CodeEnd,
+	'P': CodeF1,
+	'Q': CodeF2,
+	'R': CodeF3,
+	'S': CodeF4,
+}
+
+var csiTildeCodes = map[int]Code{
+	1:  CodeHome,
+	2:  CodeInsert,
+	3:  CodeDelete,
+	4:  CodeEnd,
+	5:  CodePageUp,
+	6:  CodePageDown,
+	7:  CodeHome,
+	8:  CodeEnd,
+	11: CodeF1,
+	12: CodeF2,
+	13: CodeF3,
+	14: CodeF4,
+	15: CodeF5,
+	17: CodeF6,
+	18: CodeF7,
+	19: CodeF8,
+	20: CodeF9,
+	21: CodeF10,
+	23: CodeF11,
+	24: CodeF12,
+}
+
+// decodeCSI decodes a control sequence such as "\x1b[A" or "\x1b[1;5C". The
+// second parameter, if present, encodes the modifiers as 1 plus a bitmask
+// of Shift, Alt and Ctrl.
+func decodeCSI(buf []byte) (Key, int, bool) {
+	end := 2
+	for end < len(buf) && (buf[end] < 0x40 || buf[end] > 0x7e) {
+		end++
+	}
+	if end >= len(buf) {
+		return Key{}, 0, false
+	}
+	final := buf[end]
+	params := strings.Split(string(buf[2:end]), ";")
+	n := end + 1
+
+	var mods Modifiers
+	if len(params) > 1 {
+		if m, err := strconv.Atoi(params[1]); err == nil && m > 1 {
+			mods = Modifiers(m - 1)
+		}
+	}
+
+	if final == 'Z' {
+		return Key{Code: CodeTab, Modifiers: ModShift}, n, true
+	}
+	if code, ok := csiLetterCodes[final]; ok {
+		return Key{Code: code, Modifiers: mods}, n, true
+	}
+	if final == '~' {
+		if p, err := strconv.Atoi(params[0]); err == nil {
+			if code, ok := csiTildeCodes[p]; ok {
+				return Key{Code: code, Modifiers: mods}, n, true
+			}
+		}
+	}
+	// Swallow sequences we don't know rather than typing them as text
+	return noKey, n, true
+}
@@ -0,0 +1,80 @@
+package keys
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Key
+	}{
+		{"text", "ab", []Key{Rune('a'), Rune('b')}},
+		{"multibyte", "é", []Key{Rune('é')}},
+		{"enter", "\r", []Key{{Code: CodeEnter}}},
+		{"ctrl", "\x01\x1d", []Key{{Code: CodeRune, Rune: 'a', Modifiers: ModCtrl}, {Code: CodeRune, Rune: ']', Modifiers: ModCtrl}}},
+		{"arrow", "\x1b[A", []Key{{Code: CodeUp}}},
+		{"ss3 arrow", "\x1bOB", []Key{{Code: CodeDown}}},
+		{"modified arrow", "\x1b[1;5C", []Key{{Code: CodeRight, Modifiers: ModCtrl}}},
+		{"tilde", "\x1b[3~", []Key{{Code: CodeDelete}}},
+		{"shift tab", "\x1b[Z", []Key{{Code: CodeTab, Modifiers: ModShift}}},
+		{"alt", "\x1bx", []Key{{Code: CodeRune, Rune: 'x', Modifiers: ModAlt}}},
+		{"focus in", "\x1b[Ia", []Key{Rune('a')}},
+		{"focus out", "\x1b[O", nil},
+		{"bracketed paste", "\x1b[200~hi\x1b[201~", []Key{Rune('h'), Rune('i')}},
+		{"device attributes", "\x1b[?1;2cx", []Key{Rune('x')}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeAll(t, tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoding %q gave %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLoneEscape(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	out := make(chan Key)
+	go NewDecoder(r, time.Millisecond).Run(out)
+	if _, err := w.Write([]byte{esc}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case k := <-out:
+		if want := (Key{Code: CodeEscape}); k != want {
+			t.Errorf("decoding a lone escape gave %v, want %v", k, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("a lone escape wasn't decoded after the escape timeout")
+	}
+}
+
+// decodeAll runs a decoder over input and returns the keys it sends
+func decodeAll(t *testing.T, input string) []Key {
+	t.Helper()
+	out := make(chan Key)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewDecoder(strings.NewReader(input), time.Millisecond).Run(out)
+	}()
+
+	var ks []Key
+	for {
+		select {
+		case k := <-out:
+			ks = append(ks, k)
+		case err := <-done:
+			if err != io.EOF {
+				t.Fatalf("Run() = %v, want EOF", err)
+			}
+			return ks
+		}
+	}
+}
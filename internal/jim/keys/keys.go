@@ -0,0 +1,237 @@
+// Package keys describes keypresses and decodes them from the byte stream of
+// a terminal in raw mode
+package keys
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Code identifies a key. Keys that produce a character use CodeRune.
+type Code int
+
+const (
+	CodeRune Code = iota
+	CodeEnter
+	CodeEscape
+	CodeBackspace
+	CodeTab
+	CodeUp
+	CodeDown
+	CodeLeft
+	CodeRight
+	CodeHome
+	CodeEnd
+	CodePageUp
+	CodePageDown
+	CodeInsert
+	CodeDelete
+	CodeF1
+	CodeF2
+	CodeF3
+	CodeF4
+	CodeF5
+	CodeF6
+	CodeF7
+	CodeF8
+	CodeF9
+	CodeF10
+	CodeF11
+	CodeF12
+)
+
+// Modifiers is a set of modifier keys held down with a key
+type Modifiers uint8
+
+const (
+	ModShift Modifiers = 1 << iota
+	ModAlt
+	ModCtrl
+)
+
+// Key is a single keypress. Shifted characters are represented by the
+// character they produce rather than ModShift, and Ctrl combinations with
+// letters use the lowercase letter, so that equal keypresses compare equal.
+type Key struct {
+	Code      Code
+	Rune      rune
+	Modifiers Modifiers
+}
+
+// Rune returns the key for typing a character
+func Rune(r rune) Key {
+	return Key{Code: CodeRune, Rune: r}
+}
+
+// IsText reports whether the key types a character without modifiers
+func (k Key) IsText() bool {
+	return k.Code == CodeRune && k.Modifiers&(ModCtrl|ModAlt) == 0
+}
+
+var codeNames = map[Code]string{
+	CodeEnter:     "CR",
+	CodeEscape:    "Esc",
+	CodeBackspace: "BS",
+	CodeTab:       "Tab",
+	CodeUp:        "Up",
+	CodeDown:      "Down",
+	CodeLeft:      "Left",
+	CodeRight:     "Right",
+	CodeHome:      "Home",
+	CodeEnd:       "End",
+	CodePageUp:    "PageUp",
+	CodePageDown:  "PageDown",
+	CodeInsert:    "Insert",
+	CodeDelete:    "Del",
+	CodeF1:        "F1",
+	CodeF2:        "F2",
+	CodeF3:        "F3",
+	CodeF4:        "F4",
+	CodeF5:        "F5",
+	CodeF6:        "F6",
+	CodeF7:        "F7",
+	CodeF8:        "F8",
+	CodeF9:        "F9",
+	CodeF10:       "F10",
+	CodeF11:       "F11",
+	CodeF12:       "F12",
+}
+
+// namedCodes maps the lowercase names accepted in key notation to key codes
+var namedCodes = map[string]Code{
+	"return": CodeEnter,
+	"enter":  CodeEnter,
+	"escape": CodeEscape,
+	"delete": CodeDelete,
+}
+
+// namedRunes maps the lowercase names of characters that can't be written
+// literally in key notation
+var namedRunes = map[string]rune{
+	"space":  ' ',
+	"lt":     '<',
+	"bslash": '\\',
+	"bar":    '|',
+}
+
+func init() {
+	for code, name := range codeNames {
+		namedCodes[strings.ToLower(name)] = code
+	}
+}
+
+// String returns the key in the notation accepted by Parse, such as "a",
+// "<C-w>", "<M-x>" or "<Up>"
+func (k Key) String() string {
+	var name string
+	switch {
+	case k.Code != CodeRune:
+		name = codeNames[k.Code]
+	case k.Rune == ' ' && k.Modifiers != 0:
+		name = "Space"
+	case k.Rune == '<':
+		name = "lt"
+	case k.Modifiers == 0:
+		return string(k.Rune)
+	default:
+		name = string(k.Rune)
+	}
+	var prefix strings.Builder
+	if k.Modifiers&ModShift != 0 {
+		prefix.WriteString("S-")
+	}
+	if k.Modifiers&ModCtrl != 0 {
+		prefix.WriteString("C-")
+	}
+	if k.Modifiers&ModAlt != 0 {
+		prefix.WriteString("M-")
+	}
+	return "<" + prefix.String() + name + ">"
+}
+
+// Format returns a sequence of keys in key notation
+func Format(ks []Key) string {
+	var sb strings.Builder
+	for _, k := range ks {
+		sb.WriteString(k.String())
+	}
+	return sb.String()
+}
+
+// Parse converts key notation into keys. Characters stand for themselves and
+// special keys are written in angle brackets, optionally with modifiers:
+// "<C-w>", "<M-x>", "<S-Tab>", "<Up>", "<F5>", "<CR>", "<Esc>", "<lt>".
+// Angle brackets that don't contain a key name are taken literally.
+func Parse(notation string) []Key {
+	var ks []Key
+	runes := []rune(notation)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '<' {
+			if end := indexRune(runes[i+1:], '>'); end > 0 {
+				if k, ok := parseSpecial(string(runes[i+1 : i+1+end])); ok {
+					ks = append(ks, k)
+					i += end + 1
+					continue
+				}
+			}
+		}
+		ks = append(ks, Rune(runes[i]))
+	}
+	return ks
+}
+
+func indexRune(runes []rune, r rune) int {
+	for i, c := range runes {
+		if c == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSpecial parses the contents of an angle bracketed key
+func parseSpecial(s string) (Key, bool) {
+	var mods Modifiers
+	for len(s) > 2 && s[1] == '-' {
+		switch unicode.ToLower(rune(s[0])) {
+		case 's':
+			mods |= ModShift
+		case 'c':
+			mods |= ModCtrl
+		case 'm', 'a':
+			mods |= ModAlt
+		default:
+			return Key{}, false
+		}
+		s = s[2:]
+	}
+
+	if code, ok := namedCodes[strings.ToLower(s)]; ok {
+		return Key{Code: code, Modifiers: mods}, true
+	}
+	r, ok := namedRunes[strings.ToLower(s)]
+	if !ok {
+		runes := []rune(s)
+		if len(runes) != 1 || mods == 0 {
+			return Key{}, false
+		}
+		r = runes[0]
+	}
+	return normalize(Key{Code: CodeRune, Rune: r, Modifiers: mods}), true
+}
+
+// normalize puts character keys in their canonical form: Shift is folded
+// into the character and Ctrl combinations use lowercase letters
+func normalize(k Key) Key {
+	if k.Code != CodeRune {
+		return k
+	}
+	if k.Modifiers&ModShift != 0 && unicode.IsLetter(k.Rune) {
+		k.Rune = unicode.ToUpper(k.Rune)
+		k.Modifiers &^= ModShift
+	}
+	if k.Modifiers&ModCtrl != 0 {
+		k.Rune = unicode.ToLower(k.Rune)
+	}
+	return k
+}
@@ -6,9 +6,19 @@ const (
 	ModeNormal Mode = iota
 	ModeInsert
 	ModeCommand
+	// ModeOperatorPending waits for the motion or text object an operator applies to
+	ModeOperatorPending
+	ModeVisual
+	ModeVisualLine
+	ModeVisualBlock
 )
 
 // String - Creating common behavior - give the type a String function
 func (m Mode) String() string {
-	return [...]string{"Normal", "Insert", "Command"}[m]
+	return [...]string{"Normal", "Insert", "Command", "Operator-pending", "Visual", "Visual Line", "Visual Block"}[m]
+}
+
+// IsVisual reports whether the mode selects text
+func (m Mode) IsVisual() bool {
+	return m == ModeVisual || m == ModeVisualLine || m == ModeVisualBlock
 }
@@ -0,0 +1,275 @@
+// Package regex compiles Vim search patterns into Go regular expressions
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// magic is how many characters are special without a backslash, as changed
+// by \V, \M, \m and \v in a pattern
+type magic int
+
+const (
+	veryNoMagic magic = iota
+	noMagic
+	defaultMagic
+	veryMagic
+)
+
+// special returns the characters with a special meaning without a backslash
+// at each magic level. The others in veryMagic's set are special with one.
+var special = map[magic]string{
+	veryNoMagic:  "",
+	noMagic:      "^$",
+	defaultMagic: "^$.*[~",
+	veryMagic:    "^$.*[~()|+?={@%<>",
+}
+
+// classes are the character classes written with a backslash
+var classes = map[rune]string{
+	// Vim's \s doesn't match newlines, unlike Go's
+	's': `[\t ]`,
+	'S': `[^\t \n]`,
+	'd': `[0-9]`,
+	'D': `[^0-9\n]`,
+	'w': `[0-9A-Za-z_]`,
+	'W': `[^0-9A-Za-z_\n]`,
+	'a': `[A-Za-z]`,
+	'A': `[^A-Za-z\n]`,
+	'l': `[a-z]`,
+	'L': `[^a-z\n]`,
+	'u': `[A-Z]`,
+	'U': `[^A-Z\n]`,
+	'x': `[0-9A-Fa-f]`,
+	'X': `[^0-9A-Fa-f\n]`,
+	'o': `[0-7]`,
+	'O': `[^0-7\n]`,
+	'h': `[A-Za-z_]`,
+	'H': `[^A-Za-z_\n]`,
+	'n': `\n`,
+	't': `\t`,
+	'r': `\r`,
+	'e': `\x1b`,
+}
+
+// Compile compiles a Vim pattern. The pattern ignores case if ignoreCase is
+// set, unless smartCase is set too and the pattern contains an uppercase
+// letter. \c and \C in the pattern override both. ^ and $ match at the start
+// and end of every line.
+func Compile(pattern string, ignoreCase, smartCase bool) (*regexp.Regexp, error) {
+	expr, fold, err := Translate(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if fold == nil {
+		ignore := ignoreCase && !(smartCase && HasUpper(pattern))
+		fold = &ignore
+	}
+	flags := "(?m)"
+	if *fold {
+		flags = "(?mi)"
+	}
+	re, err := regexp.Compile(flags + expr)
+	if err != nil {
+		return nil, fmt.Errorf("E383: Invalid search string: %s", pattern)
+	}
+	return re, nil
+}
+
+// HasUpper reports whether a pattern contains an uppercase letter, not
+// counting the letters of backslash sequences such as \S
+func HasUpper(pattern string) bool {
+	escaped := false
+	for _, r := range pattern {
+		if !escaped && unicode.IsUpper(r) {
+			return true
+		}
+		escaped = !escaped && r == '\\'
+	}
+	return false
+}
+
+// Translate converts a Vim pattern to Go's regexp syntax. It supports the
+// magic levels \v, \m, \M and \V, groups, alternation, multis including
+// \{n,m} and \{-}, collections, word boundaries \< and \>, and the common
+// character classes. fold is set if the pattern contains \c (true) or \C
+// (false).
+func Translate(pattern string) (expr string, fold *bool, err error) {
+	var sb strings.Builder
+	level := defaultMagic
+	runes := []rune(pattern)
+	// branchStart is set where ^ starts a line, at the start of the pattern,
+	// a group or an alternative
+	branchStart := true
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		escaped := false
+		if r == '\\' && i+1 < len(runes) {
+			i++
+			r = runes[i]
+			escaped = true
+		}
+		atStart := branchStart
+		branchStart = false
+
+		// Characters that are special at some level are special when
+		// their backslash and the level disagree
+		if strings.ContainsRune(special[veryMagic], r) {
+			isSpecial := escaped != strings.ContainsRune(special[level], r)
+			switch {
+			case r == '^' && level != veryMagic:
+				isSpecial = isSpecial && atStart
+			case r == '$' && level != veryMagic:
+				isSpecial = isSpecial && atBranchEnd(runes[i+1:], level)
+			}
+			if !isSpecial {
+				sb.WriteString(regexp.QuoteMeta(string(r)))
+				continue
+			}
+			n, err := translateSpecial(&sb, runes, i)
+			if err != nil {
+				return "", nil, err
+			}
+			i = n
+			branchStart = r == '(' || r == '|' || r == '%'
+			continue
+		}
+		if !escaped {
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			continue
+		}
+
+		switch {
+		case r == 'v', r == 'm', r == 'M', r == 'V':
+			level = map[rune]magic{'v': veryMagic, 'm': defaultMagic, 'M': noMagic, 'V': veryNoMagic}[r]
+			branchStart = atStart
+		case r == 'c', r == 'C':
+			ignore := r == 'c'
+			fold = &ignore
+			branchStart = atStart
+		case classes[r] != "":
+			sb.WriteString(classes[r])
+		case r == '_' && i+1 < len(runes) && runes[i+1] == '.':
+			i++
+			sb.WriteString(`(?s:.)`)
+		case r == '_' && i+1 < len(runes) && classes[runes[i+1]] != "":
+			// \_x is class x or a newline
+			i++
+			sb.WriteString(`(?:\n|` + classes[runes[i]] + `)`)
+		case r >= '1' && r <= '9', r == 'z', r == '_':
+			return "", nil, fmt.Errorf("unsupported pattern item: \\%c", r)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return sb.String(), fold, nil
+}
+
+// atBranchEnd reports whether rest starts at the end of the pattern, a group
+// or an alternative, where $ matches the end of a line
+func atBranchEnd(rest []rune, level magic) bool {
+	if len(rest) == 0 {
+		return true
+	}
+	if level == veryMagic {
+		return rest[0] == ')' || rest[0] == '|'
+	}
+	return len(rest) > 1 && rest[0] == '\\' && (rest[1] == ')' || rest[1] == '|')
+}
+
+// translateSpecial writes the Go syntax for the special character at runes[i]
+// and returns the index of the last rune it used
+func translateSpecial(sb *strings.Builder, runes []rune, i int) (int, error) {
+	switch r := runes[i]; r {
+	case '<', '>':
+		sb.WriteString(`\b`)
+	case '=':
+		sb.WriteString("?")
+	case '~':
+		// The last substitute string isn't tracked, so ~ matches itself
+		sb.WriteString("~")
+	case '[':
+		return translateCollection(sb, runes, i)
+	case '{':
+		return translateBraces(sb, runes, i)
+	case '%':
+		if i+1 < len(runes) && runes[i+1] == '(' {
+			sb.WriteString("(?:")
+			return i + 1, nil
+		}
+		return i, fmt.Errorf("unsupported pattern item: %%")
+	case '@':
+		return i, fmt.Errorf("unsupported pattern item: @")
+	default:
+		sb.WriteRune(r)
+	}
+	return i, nil
+}
+
+// translateCollection writes a [] collection. Negated collections don't match
+// newlines, as in Vim. A [ without a closing ] matches itself.
+func translateCollection(sb *strings.Builder, runes []rune, i int) (int, error) {
+	end := i + 1
+	if end < len(runes) && runes[end] == '^' {
+		end++
+	}
+	if end < len(runes) && runes[end] == ']' {
+		end++
+	}
+	for ; end < len(runes) && runes[end] != ']'; end++ {
+		if runes[end] == '\\' {
+			end++
+		} else if runes[end] == '[' && end+1 < len(runes) && runes[end+1] == ':' {
+			// Skip over a class such as [:alpha:]
+			for j := end + 2; j+1 < len(runes); j++ {
+				if runes[j] == ':' && runes[j+1] == ']' {
+					end = j + 1
+					break
+				}
+			}
+		}
+	}
+	if end >= len(runes) {
+		sb.WriteString(`\[`)
+		return i, nil
+	}
+	body := string(runes[i+1 : end])
+	if strings.HasPrefix(body, "^") {
+		body = `^\n` + body[1:]
+	}
+	sb.WriteString("[" + body + "]")
+	return end, nil
+}
+
+// translateBraces writes a \{n,m} multi. A leading - makes it match as few
+// times as possible.
+func translateBraces(sb *strings.Builder, runes []rune, i int) (int, error) {
+	end := i + 1
+	for end < len(runes) && runes[end] != '}' {
+		end++
+	}
+	if end >= len(runes) {
+		return i, fmt.Errorf("E60: Missing }")
+	}
+	body := strings.TrimSuffix(string(runes[i+1:end]), `\`)
+	lazy := strings.HasPrefix(body, "-")
+	body = strings.TrimPrefix(body, "-")
+	lo, hi, hasComma := strings.Cut(body, ",")
+	switch {
+	case body == "" || body == ",":
+		sb.WriteString("*")
+	case !hasComma:
+		sb.WriteString("{" + lo + "}")
+	case lo == "":
+		sb.WriteString("{0," + hi + "}")
+	default:
+		sb.WriteString("{" + lo + "," + hi + "}")
+	}
+	if lazy {
+		sb.WriteString("?")
+	}
+	return end, nil
+}
@@ -0,0 +1,90 @@
+package regex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    []string
+	}{
+		{"a.c", "abc a.c", []string{"abc", "a.c"}},
+		{`a\.c`, "abc a.c", []string{"a.c"}},
+		{"ab*", "a abbb", []string{"a", "abbb"}},
+		{`ab\+`, "a abbb", []string{"abbb"}},
+		{`ab\=c`, "ac abc", []string{"ac", "abc"}},
+		{"a+", "aa a+", []string{"a+"}},
+		{`\(ab\)\{2}`, "ab abab", []string{"abab"}},
+		{`a\{-1,}`, "aaa", []string{"a", "a", "a"}},
+		{`a\{2,3}`, "aaaa", []string{"aaa"}},
+		{`a\|b`, "abc", []string{"a", "b"}},
+		{`\<is\>`, "this is", []string{"is"}},
+		{"^a", "aa\na", []string{"a", "a"}},
+		{"a$", "aa\na", []string{"a", "a"}},
+		{"a^", "a^", []string{"a^"}},
+		{"$a", "$a", []string{"$a"}},
+		{"[a-c]", "abd", []string{"a", "b"}},
+		{"[^a]", "ab\n", []string{"b"}},
+		{"[abc", "[abc", []string{"[abc"}},
+		{`\d\+`, "a12 3", []string{"12", "3"}},
+		{`\s`, "a b\n", []string{" "}},
+		{`\S\+`, "ab c\nd", []string{"ab", "c", "d"}},
+		{`a\nb`, "a\nb", []string{"a\nb"}},
+		{`a\_.b`, "a\nb", []string{"a\nb"}},
+		{`\v(ab)+`, "abab", []string{"abab"}},
+		{`\v<is>`, "this is", []string{"is"}},
+		{`\Va.c`, "abc a.c", []string{"a.c"}},
+		{`\Ma*`, "aa a*", []string{"a*"}},
+		{`\%(a\|b\)c`, "ac bc", []string{"ac", "bc"}},
+		{`\cABC`, "abc", []string{"abc"}},
+		{`abc\C`, "ABC", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := Compile(tt.pattern, false, false)
+			if err != nil {
+				t.Fatalf("Compile(%q) error: %v", tt.pattern, err)
+			}
+			if got := re.FindAllString(tt.text, -1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q matched %q in %q, want %q", tt.pattern, got, tt.text, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileCase(t *testing.T) {
+	tests := []struct {
+		pattern               string
+		ignoreCase, smartCase bool
+		want                  bool
+	}{
+		{"abc", false, false, false},
+		{"abc", true, false, true},
+		{"abc", true, true, true},
+		{"aBc", true, true, false},
+		{"aBc", true, false, true},
+		{`\Sbc`, true, true, true},
+		{`abc\C`, true, false, false},
+		{`\cabc`, false, false, true},
+	}
+	for _, tt := range tests {
+		re, err := Compile(tt.pattern, tt.ignoreCase, tt.smartCase)
+		if err != nil {
+			t.Fatalf("Compile(%q) error: %v", tt.pattern, err)
+		}
+		if got := re.MatchString("ABC"); got != tt.want {
+			t.Errorf("Compile(%q, %v, %v) matching ABC = %v, want %v", tt.pattern, tt.ignoreCase, tt.smartCase, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, pattern := range []string{`a\{2`, `\1`, `a\@=`, `\v(a`} {
+		if _, err := Compile(pattern, false, false); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", pattern)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package registers stores the text yanked, deleted and recorded in the
+// editor under single character names, following Vim's register semantics
+package registers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jstotz/jim/internal/jim/clipboard"
+)
+
+// Unnamed is the register used when none is given. It refers to the register
+// written most recently.
+const Unnamed = '"'
+
+// Type is how the text of a register is put back into a buffer
+type Type int
+
+const (
+	Charwise Type = iota
+	// Linewise text is made of full lines, each ending in a newline
+	Linewise
+	// Blockwise text is a newline separated column of text
+	Blockwise
+)
+
+// String returns the type as shown by :registers
+func (t Type) String() string {
+	return [...]string{"c", "l", "b"}[t]
+}
+
+// ParseType parses a type name as used by the Lua API: "c" or "v" for
+// charwise, "l" or "V" for linewise and "b" for blockwise
+func ParseType(name string) (Type, error) {
+	switch name {
+	case "", "c", "v":
+		return Charwise, nil
+	case "l", "V":
+		return Linewise, nil
+	case "b":
+		return Blockwise, nil
+	}
+	return Charwise, fmt.Errorf("invalid register type: %s", name)
+}
+
+type Register struct {
+	Text string
+	Type Type
+}
+
+// Store holds the contents of the registers
+type Store struct {
+	registers map[rune]Register
+	// unnamed is the register the unnamed register refers to
+	unnamed rune
+	// clipboard backs the + and * registers if set
+	clipboard clipboard.Provider
+}
+
+func NewStore() *Store {
+	return &Store{registers: map[rune]Register{}, unnamed: '0'}
+}
+
+// SetClipboard backs the + and * registers with the system clipboard
+func (s *Store) SetClipboard(p clipboard.Provider) {
+	s.clipboard = p
+}
+
+// selections maps the clipboard registers to the clipboards they use
+var selections = map[rune]clipboard.Selection{'+': clipboard.Clipboard, '*': clipboard.Primary}
+
+// readOnly registers are set by the editor: the last inserted text, the
+// current and alternate file names, the last command line and the last
+// search pattern
+const readOnly = ".%#:/"
+
+// Valid reports whether name is a register name
+func Valid(name rune) bool {
+	switch {
+	case name == Unnamed, name == '_', name == '-', name == '+', name == '*', strings.ContainsRune(readOnly, name):
+		return true
+	case name >= '0' && name <= '9', name >= 'a' && name <= 'z', name >= 'A' && name <= 'Z':
+		return true
+	}
+	return false
+}
+
+// Writable reports whether name is a register that can be written
+func Writable(name rune) bool {
+	return Valid(name) && !strings.ContainsRune(readOnly, name)
+}
+
+// Get returns the contents of a register. Registers that were never written
+// are empty.
+func (s *Store) Get(name rune) (Register, error) {
+	if !Valid(name) {
+		return Register{}, fmt.Errorf("invalid register name: %q", name)
+	}
+	switch {
+	case name == Unnamed:
+		name = s.unnamed
+	case name == '_':
+		return Register{}, nil
+	}
+	if sel, ok := selections[name]; ok && s.clipboard != nil {
+		return s.paste(name, sel)
+	}
+	return s.registers[unicode.ToLower(name)], nil
+}
+
+// paste reads a clipboard register. Text copied from the editor keeps the type
+// it was copied with; other text is linewise if it ends in a newline.
+func (s *Store) paste(name rune, sel clipboard.Selection) (Register, error) {
+	text, err := s.clipboard.Paste(sel)
+	if err != nil {
+		return Register{}, err
+	}
+	if r := s.registers[name]; r.Text == text {
+		return r, nil
+	}
+	if strings.HasSuffix(text, "\n") {
+		return Register{Text: text, Type: Linewise}, nil
+	}
+	return Register{Text: text, Type: Charwise}, nil
+}
+
+// Set writes a register. Uppercase names append to the lowercase register.
+// Writing the unnamed register writes register 0. Linewise text is given a
+// trailing newline if it has none.
+func (s *Store) Set(name rune, r Register) error {
+	if !Valid(name) {
+		return fmt.Errorf("invalid register name: %q", name)
+	}
+	if strings.ContainsRune(readOnly, name) {
+		return fmt.Errorf("register %c is read-only", name)
+	}
+	if r.Type == Linewise && !strings.HasSuffix(r.Text, "\n") {
+		r.Text += "\n"
+	}
+	switch name {
+	case '_':
+		return nil
+	case Unnamed:
+		name = '0'
+	case '+', '*':
+		if s.clipboard != nil {
+			if err := s.clipboard.Copy(selections[name], r.Text); err != nil {
+				return err
+			}
+		}
+	}
+	s.write(name, r)
+	return nil
+}
+
+// write stores r in a register, appending for uppercase names, and points the
+// unnamed register at it
+func (s *Store) write(name rune, r Register) {
+	lower := unicode.ToLower(name)
+	if name != lower {
+		r = appendRegister(s.registers[lower], r)
+	}
+	s.registers[lower] = r
+	s.unnamed = lower
+}
+
+// appendRegister appends r to existing. Appending lines to characters or
+// characters to lines results in lines.
+func appendRegister(existing, r Register) Register {
+	if existing.Text == "" {
+		return r
+	}
+	switch {
+	case existing.Type == Linewise || r.Type == Linewise:
+		text := strings.TrimSuffix(existing.Text, "\n") + "\n" + r.Text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		return Register{Text: text, Type: Linewise}
+	case existing.Type == Blockwise || r.Type == Blockwise:
+		return Register{Text: existing.Text + "\n" + r.Text, Type: Blockwise}
+	}
+	return Register{Text: existing.Text + r.Text, Type: Charwise}
+}
+
+// Yank stores yanked text in the named register, or in register 0 if name is
+// the unnamed register
+func (s *Store) Yank(name rune, r Register) error {
+	if name == Unnamed {
+		s.write('0', r)
+		return nil
+	}
+	return s.Set(name, r)
+}
+
+// Delete stores deleted text in the named register. Without a name, deletes
+// of a line or more shift numbered registers 1-8 into 2-9 and are stored in
+// register 1, while smaller deletes go to the - register.
+func (s *Store) Delete(name rune, r Register) error {
+	if name != Unnamed {
+		return s.Set(name, r)
+	}
+	if r.Type == Charwise && !strings.Contains(r.Text, "\n") {
+		s.write('-', r)
+		return nil
+	}
+	for n := '9'; n > '1'; n-- {
+		s.registers[n] = s.registers[n-1]
+	}
+	s.write('1', r)
+	return nil
+}
+
+// SetReadOnly sets one of the registers maintained by the editor
+func (s *Store) SetReadOnly(name rune, text string) {
+	s.registers[name] = Register{Text: text}
+}
+
+// List describes the non-empty registers, one per line, in the format of
+// Vim's :registers
+func (s *Store) List() string {
+	names := []rune{Unnamed}
+	for name, r := range s.registers {
+		if r.Text != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names[1:], func(i, j int) bool {
+		return registerOrder(names[i+1]) < registerOrder(names[j+1])
+	})
+
+	lines := []string{"Type Name Content"}
+	for _, name := range names {
+		// The clipboard isn't read so that listing is quick
+		r := s.registers[name]
+		if name == Unnamed {
+			r, _ = s.Get(name)
+		}
+		if r.Text == "" {
+			continue
+		}
+		text := strings.ReplaceAll(r.Text, "\n", "^J")
+		lines = append(lines, fmt.Sprintf("  %s  \"%c   %s", r.Type, name, text))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// registerOrder sorts registers the way :registers lists them
+func registerOrder(name rune) int {
+	order := `"0123456789abcdefghijklmnopqrstuvwxyz-.:%#/*+`
+	return strings.IndexRune(order, name)
+}
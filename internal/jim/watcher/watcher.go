@@ -0,0 +1,82 @@
+// Package watcher notifies the editor when files it has open change on disk
+package watcher
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// Watcher sends the path of a watched file on Events whenever the file is
+// written, replaced or removed. Directories are watched rather than the files
+// themselves so that files replaced by a rename are still noticed.
+type Watcher struct {
+	events chan string
+	mu     sync.Mutex
+	files  map[string]bool
+	backend
+}
+
+func New() (*Watcher, error) {
+	w := &Watcher{
+		events: make(chan string, 16),
+		files:  map[string]bool{},
+	}
+	if err := w.backend.start(w.notify); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Events returns the channel that changed file paths are sent on
+func (w *Watcher) Events() <-chan string {
+	return w.events
+}
+
+// Add starts watching the file at path
+func (w *Watcher) Add(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.files[path] {
+		return nil
+	}
+	if err := w.backend.watchDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	w.files[path] = true
+	return nil
+}
+
+// Remove stops watching the file at path
+func (w *Watcher) Remove(path string) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.files, path)
+}
+
+// Close stops watching all files
+func (w *Watcher) Close() error {
+	return w.backend.close()
+}
+
+// notify is called by the backend for every changed path in a watched
+// directory. Changes are dropped rather than blocking if nobody is reading.
+func (w *Watcher) notify(path string) {
+	w.mu.Lock()
+	watched := w.files[path]
+	w.mu.Unlock()
+	if !watched {
+		return
+	}
+	select {
+	case w.events <- path:
+	default:
+	}
+}
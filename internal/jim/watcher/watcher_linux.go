@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE | unix.IN_DELETE | unix.IN_ATTRIB
+
+// backend watches directories with inotify
+type backend struct {
+	file *os.File
+	mu   sync.Mutex
+	dirs map[int]string
+}
+
+func (b *backend) start(notify func(path string)) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify init: %w", err)
+	}
+	// A non-blocking file uses the runtime poller, so closing it unblocks the
+	// reading goroutine
+	b.file = os.NewFile(uintptr(fd), "inotify")
+	b.dirs = map[int]string{}
+	go b.read(notify)
+	return nil
+}
+
+func (b *backend) watchDir(dir string) error {
+	wd, err := unix.InotifyAddWatch(int(b.file.Fd()), dir, watchMask)
+	if err != nil {
+		return fmt.Errorf("inotify watch %s: %w", dir, err)
+	}
+	b.mu.Lock()
+	b.dirs[wd] = dir
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *backend) read(notify func(path string)) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := b.file.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00")
+			offset = nameStart + int(event.Len)
+
+			b.mu.Lock()
+			dir, ok := b.dirs[int(event.Wd)]
+			b.mu.Unlock()
+			if ok && len(name) > 0 {
+				notify(filepath.Join(dir, string(name)))
+			}
+		}
+	}
+}
+
+func (b *backend) close() error {
+	return b.file.Close()
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package watcher
+
+// backend is a noop on platforms without inotify. Changes are still noticed
+// when the editor checks files explicitly.
+type backend struct{}
+
+func (b *backend) start(notify func(path string)) error {
+	return nil
+}
+
+func (b *backend) watchDir(dir string) error {
+	return nil
+}
+
+func (b *backend) close() error {
+	return nil
+}